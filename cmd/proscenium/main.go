@@ -0,0 +1,30 @@
+// Command proscenium drives the builder, resolver and compiler outside of Ruby, which is useful for
+// debugging and reproducing builds.
+//
+// Usage:
+//
+//	proscenium build <specifier> [flags]
+//	proscenium resolve <specifier> [-importer path] [flags]
+//	proscenium compile [flags]
+//	proscenium watch [flags]
+//
+// The config is read as JSON from the file given to `-config` (or "-" for stdin), or from the
+// PROSCENIUM_CONFIG environment variable, and accepts the same keys as `types.ConfigT`. Flags
+// override the values of the config.
+package main
+
+import (
+	"context"
+	"joelmoss/proscenium/internal/cli"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	code := cli.Run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr)
+	stop()
+
+	os.Exit(code)
+}
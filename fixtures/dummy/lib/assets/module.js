@@ -0,0 +1,3 @@
+import styles from "./logo.module.css";
+
+console.log(styles.logo);
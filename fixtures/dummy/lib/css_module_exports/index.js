@@ -0,0 +1,2 @@
+import styles, { button } from "./styles.module.css";
+console.log(button, styles["nav-item"]);
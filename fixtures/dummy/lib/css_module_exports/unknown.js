@@ -0,0 +1,2 @@
+import { buton } from "./styles.module.css";
+console.log(buton);
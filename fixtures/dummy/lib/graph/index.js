@@ -0,0 +1,5 @@
+import father from "../code_splitting/father";
+
+console.log(father());
+
+import("./lazy");
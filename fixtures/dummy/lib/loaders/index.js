@@ -0,0 +1,4 @@
+import hello from "./hello.txt";
+import shader from "/lib/loaders/shader.glsl";
+
+console.log(hello, shader);
@@ -0,0 +1,3 @@
+import hello from "./hello.md";
+
+console.log(hello);
@@ -0,0 +1,4 @@
+import styles from "/lib/styles.module.css";
+import "/lib/foo.css";
+
+global.rendered = styles.title;
@@ -12,12 +12,12 @@ import (
 	esbuild "github.com/joelmoss/esbuild-internal/api"
 )
 
-// Build the given `path`.
+// Build the given `path` with the given `config`.
 //
 // - path - The path to build relative to `root`.
 //
 //export build
-func build(entryPoint string) esbuild.BuildResult {
+func build(config *types.ConfigT, entryPoint string) esbuild.BuildResult {
 	_, err := replacements.Build()
 	if err != nil {
 		return esbuild.BuildResult{
@@ -38,10 +38,10 @@ func build(entryPoint string) esbuild.BuildResult {
 		}
 	}
 
-	minify := !types.Config.InternalTesting && !types.Config.Debug && types.Config.Environment != types.DevEnv
+	minify := !config.InternalTesting && !config.Debug && config.Environment != types.DevEnv
 
 	logLevel := esbuild.LogLevelWarning
-	if types.Config.Debug {
+	if config.Debug {
 		logLevel = esbuild.LogLevelDebug
 	}
 
@@ -49,59 +49,82 @@ func build(entryPoint string) esbuild.BuildResult {
 
 	buildOptions := esbuild.BuildOptions{
 		EntryPoints:                 []string{entryPoint},
-		Splitting:                   types.Config.CodeSplitting,
-		AbsWorkingDir:               types.Config.RootPath,
+		Splitting:                   config.CodeSplitting,
+		AbsWorkingDir:               config.RootPath,
 		LogLevel:                    logLevel,
 		LogLimit:                    1,
-		Outdir:                      types.Config.OutputDir,
+		Outdir:                      config.OutputDir,
 		Outbase:                     "./",
 		EntryNames:                  "[dir]/[name]-$[hash]$",
 		AssetNames:                  "[dir]/[name]-$[hash]$",
 		ChunkNames:                  "_asset_chunks/[name]-$[hash]$",
 		Format:                      esbuild.FormatESModule,
 		JSX:                         esbuild.JSXAutomatic,
-		JSXDev:                      types.Config.Environment != types.TestEnv && types.Config.Environment != types.ProdEnv,
+		JSXDev:                      config.Environment != types.TestEnv && config.Environment != types.ProdEnv,
 		MinifyWhitespace:            minify,
 		MinifyIdentifiers:           minify,
 		MinifySyntax:                minify,
 		DeterministicLocalCSSNaming: true,
 		Bundle:                      true,
-		Conditions:                  []string{types.Config.Environment.String(), "proscenium"},
+		Conditions:                  []string{config.Environment.String(), "proscenium"},
 		Write:                       true,
 		Sourcemap:                   esbuild.SourceMapExternal,
 		LegalComments:               esbuild.LegalCommentsNone,
-		Target:                      esbuild.ES2022,
 		Metafile:                    true,
 
-		Supported: map[string]bool{
-			// Ensure CSS nesting is transformed for browsers that don't support it.
-			"nesting": false,
-		},
-
 		// The Esbuild default places browser before module, but we're building for modern browsers
 		// which support esm. So we prioritise that. Some libraries export a "browser" build that still
 		// uses CJS.
 		MainFields: []string{"module", "browser", "main"},
 	}
 
-	buildOptions.Plugins = []esbuild.Plugin{
+	if config.Ssr {
+		// Server bundles are rendered by a JS runtime, which cannot fetch unbundled imports or split
+		// chunks, and are never served to the browser.
+		buildOptions.Platform = esbuild.PlatformNeutral
+		buildOptions.Conditions = []string{config.Environment.String(), "proscenium", "node"}
+		buildOptions.MainFields = []string{"module", "main"}
+		buildOptions.Splitting = false
+		buildOptions.Write = false
+	}
+
+	if err := utils.ApplyTargets(config, &buildOptions); err != nil {
+		return esbuild.BuildResult{
+			Errors: []esbuild.Message{{Text: "Invalid targets", Detail: err.Error()}},
+		}
+	}
+
+	if err := utils.ApplyLoaders(config, &buildOptions); err != nil {
+		return esbuild.BuildResult{
+			Errors: []esbuild.Message{{Text: "Invalid loaders", Detail: err.Error()}},
+		}
+	}
+
+	registered, err := plugin.Registered(config)
+	if err != nil {
+		return esbuild.BuildResult{
+			Errors: []esbuild.Message{{Text: "Invalid plugins", Detail: err.Error()}},
+		}
+	}
+
+	buildOptions.Plugins = append(registered,
 		plugin.Http,
-		plugin.I18n,
+		plugin.I18n(config),
 		plugin.Rjs(),
-	}
+	)
 
-	if types.Config.Bundle {
-		buildOptions.External = types.Config.External
-		buildOptions.Plugins = append(buildOptions.Plugins, plugin.Bundler)
+	if config.Bundle || config.Ssr {
+		buildOptions.External = config.External
+		buildOptions.Plugins = append(buildOptions.Plugins, plugin.Bundler(config))
 	} else {
 		buildOptions.PreserveSymlinks = true
-		buildOptions.Plugins = append(buildOptions.Plugins, plugin.Bundless)
+		buildOptions.Plugins = append(buildOptions.Plugins, plugin.Bundless(config))
 	}
 
-	buildOptions.Plugins = append(buildOptions.Plugins, plugin.Replacements, plugin.Svg, plugin.Css, plugin.Dirname)
+	buildOptions.Plugins = append(buildOptions.Plugins, plugin.Replacements, plugin.Svg, plugin.Css(config), plugin.Dirname(config))
 
 	if !utils.IsUrl(entryPoint) {
-		definitions, err := buildEnvVars()
+		definitions, err := buildEnvVars(config)
 		if err != nil {
 			return esbuild.BuildResult{
 				Errors: []esbuild.Message{{
@@ -112,30 +135,34 @@ func build(entryPoint string) esbuild.BuildResult {
 		}
 		buildOptions.Define = definitions
 		buildOptions.Define["proscenium.env.PRECOMPILED"] = "false"
-		buildOptions.Define["global"] = "window"
+		if config.Ssr {
+			buildOptions.Define["global"] = "globalThis"
+		} else {
+			buildOptions.Define["global"] = "window"
+		}
+	}
+
+	if config.Incremental {
+		return buildIncrementally(config, entryPoint, buildOptions)
 	}
 
 	return esbuild.Build(buildOptions)
 }
 
-// Maintains a cache of environment variables.
-var envVarMap = make(map[string]string, 4)
-
-func buildEnvVars() (map[string]string, error) {
-	if types.Config.Environment != types.TestEnv && len(envVarMap) > 0 {
-		return envVarMap, nil
-	}
+// Builds the map of environment variables to define for the given `config`.
+func buildEnvVars(config *types.ConfigT) (map[string]string, error) {
+	envVarMap := make(map[string]string, len(config.EnvVars)+4)
 
-	for key, value := range types.Config.EnvVars {
+	for key, value := range config.EnvVars {
 		if key != "" || value != "" {
 			envVarMap["proscenium.env."+key] = fmt.Sprintf("'%s'", value)
 		}
 	}
 
-	if len(types.Config.EnvVars) == 0 {
+	if len(config.EnvVars) == 0 {
 		// This ensures that we always have NODE_ENV and RAILS_ENV defined even the given env vars do
 		// not define them.
-		env := fmt.Sprintf("'%s'", types.Config.Environment)
+		env := fmt.Sprintf("'%s'", config.Environment)
 		envVarMap["proscenium.env.RAILS_ENV"] = env
 		envVarMap["proscenium.env.NODE_ENV"] = env
 	}
@@ -2,9 +2,11 @@ package builder
 
 import (
 	"encoding/json"
+	"fmt"
 	"joelmoss/proscenium/internal/debug"
 	"joelmoss/proscenium/internal/types"
 	"joelmoss/proscenium/internal/utils"
+	"maps"
 	"path"
 	"regexp"
 	"strings"
@@ -12,7 +14,7 @@ import (
 	esbuild "github.com/joelmoss/esbuild-internal/api"
 )
 
-var entrypointRegex = regexp.MustCompile(`(?i)(.+)\-\$[a-z0-9]+\$(\.[a-z]+(?:\.map)?)$`)
+var entrypointRegex = regexp.MustCompile(`(?i)(.+)\-\$[a-z0-9]+\$(\.[a-z0-9]+(?:\.map)?)$`)
 var extensionMap = map[string]string{
 	".jsx": ".js",
 	".ts":  ".js",
@@ -21,16 +23,25 @@ var extensionMap = map[string]string{
 	".cjs": ".js",
 }
 
-// Builds the given `filePath`, which should be a full URL path, but without the leading slash, and
-// returns the contents as a string.
+// Builds the given `filePath` with the given `config`. The `filePath` should be a full URL path, but
+// without the leading slash. Returns the contents as a string.
 //
 // Only used by the Esbuild middleware, so requires `filePath` argument to be an absolute URL path.
 // See Proscenium::Middleware::Esbuild.
-func BuildToString(filePath string) (success bool, code string, contentHash string) {
-	var pathPrefix = path.Join(types.Config.RootPath, types.Config.OutputDir) + "/"
-	var output esbuild.OutputFile
+func BuildToString(config *types.ConfigT, filePath string) (success bool, code string, contentHash string) {
+	return buildToString(config, filePath, nil)
+}
 
-	result := build(filePath)
+// Builds the given `filePath` like `BuildToString`, and also returns a strong ETag derived from the
+// inputs of that same build, which can be passed to `CheckFresh`. The ETag is empty if the build
+// failed, or if any of its inputs cannot be checked, such as virtual modules.
+func BuildToStringWithETag(config *types.ConfigT, filePath string) (success bool, code string, contentHash string, etag string) {
+	success, code, contentHash = buildToString(config, filePath, &etag)
+	return success, code, contentHash, etag
+}
+
+func buildToString(config *types.ConfigT, filePath string, etag *string) (success bool, code string, contentHash string) {
+	result := build(config, filePath)
 
 	if len(result.Errors) != 0 {
 		j, err := json.Marshal(result.Errors[0])
@@ -41,6 +52,57 @@ func BuildToString(filePath string) (success bool, code string, contentHash stri
 		return false, string(j), ""
 	}
 
+	isSourceMap := strings.HasSuffix(filePath, ".map")
+
+	// The inputs are stamped once, and each consumer given its own copy, as stamps are updated when
+	// they are checked.
+	paths, hasVirtual, ok := metafileInputPaths(config.RootPath, result.Metafile)
+	var stamps map[string]fileStamp
+	if ok {
+		stamps = stampPaths(config, paths)
+	}
+
+	if config.LiveReload && !isSourceMap {
+		recordReloadInputs("/"+filePath, maps.Clone(stamps))
+	}
+
+	output, err := findEntryOutput(config, filePath, result)
+	if err != nil {
+		return buildError(err.Error())
+	}
+
+	// Virtual modules are not stamped, so an ETag derived from the other inputs could be stale.
+	freshStamps := maps.Clone(stamps)
+	if hasVirtual {
+		freshStamps = nil
+	}
+
+	if tag := recordFreshness(config, filePath, freshStamps); etag != nil {
+		*etag = tag
+	}
+
+	contents := string(output.Contents)
+
+	if isSourceMap {
+		return true, contents, output.Hash
+	}
+
+	sourcemapUrl := path.Base(filePath)
+	if utils.PathIsCss(output.Path) {
+		contents += "/*# sourceMappingURL=" + sourcemapUrl + ".map */"
+	} else {
+		contents += "//# sourceMappingURL=" + sourcemapUrl + ".map"
+	}
+
+	return true, contents, output.Hash
+}
+
+// Returns the output file of the given build `result` of `filePath`, which is the source map of the
+// entry point if `filePath` ends with ".map".
+func findEntryOutput(config *types.ConfigT, filePath string, result esbuild.BuildResult) (esbuild.OutputFile, error) {
+	var pathPrefix = path.Join(config.RootPath, config.OutputDir) + "/"
+	var output esbuild.OutputFile
+
 	nonSourceMapFile, isSourceMap := strings.CutSuffix(filePath, ".map")
 
 	filePathWithRealExt := filePath
@@ -75,34 +137,35 @@ func BuildToString(filePath string) (success bool, code string, contentHash stri
 			}
 		}
 
-		if output.Path == "" {
-			for _, out := range result.OutputFiles {
-				substrs := entrypointRegex.FindAllStringSubmatch(out.Path, -1)[0]
-				if pathPrefix+filePathWithRealExt == substrs[1]+substrs[2] {
-					output = out
-					break
-				}
-			}
-		}
-
+		// Assets and chunks may also be output, so the entry point is found by its output in the
+		// metafile.
 		if output.Path == "" {
 			var metadata struct{ Outputs map[string]any }
 			err := json.Unmarshal([]byte(result.Metafile), &metadata)
 			if err != nil {
-				return buildError(err.Error())
+				return output, err
 			}
 
-			var epPath string
-			if isSourceMap {
-				epPath = findOutputPathForEntryPoint(nonSourceMapFile, metadata) + ".map"
-			} else {
-				epPath = findOutputPathForEntryPoint(filePath, metadata)
-			}
+			if epPath := findOutputPathForEntryPoint(nonSourceMapFile, metadata); epPath != "" {
+				if isSourceMap {
+					epPath += ".map"
+				}
+
+				epPath = path.Join(config.RootPath, epPath)
 
-			epPath = path.Join(types.Config.RootPath, epPath)
+				for _, out := range result.OutputFiles {
+					if out.Path == epPath {
+						output = out
+						break
+					}
+				}
+			}
+		}
 
+		if output.Path == "" {
 			for _, out := range result.OutputFiles {
-				if out.Path == epPath {
+				substrs := entrypointRegex.FindStringSubmatch(out.Path)
+				if substrs != nil && pathPrefix+filePathWithRealExt == substrs[1]+substrs[2] {
 					output = out
 					break
 				}
@@ -112,23 +175,10 @@ func BuildToString(filePath string) (success bool, code string, contentHash stri
 
 	if output.Path == "" {
 		debug.FDebug(filePath, result.OutputFiles)
-		return buildError("Could not find output file.")
-	}
-
-	contents := string(output.Contents)
-
-	if isSourceMap {
-		return true, contents, output.Hash
+		return output, fmt.Errorf("Could not find output file.")
 	}
 
-	sourcemapUrl := path.Base(filePath)
-	if utils.PathIsCss(output.Path) {
-		contents += "/*# sourceMappingURL=" + sourcemapUrl + ".map */"
-	} else {
-		contents += "//# sourceMappingURL=" + sourcemapUrl + ".map"
-	}
-
-	return true, contents, output.Hash
+	return output, nil
 }
 
 func findOutputPathForEntryPoint(filePath string, metadata struct{ Outputs map[string]any }) string {
@@ -5,120 +5,210 @@ import (
 	"joelmoss/proscenium/internal/plugin"
 	"joelmoss/proscenium/internal/replacements"
 	"joelmoss/proscenium/internal/types"
+	"joelmoss/proscenium/internal/utils"
 	"os"
 	"path"
 
 	esbuild "github.com/joelmoss/esbuild-internal/api"
 )
 
+// Directory within the output dir that legacy outputs are compiled to, when `LegacyTargets` is set.
+const legacyOutputDir = "legacy"
+
 type compileResult struct {
 	Errors   []esbuild.Message
 	Warnings []esbuild.Message
+
+	// The result of each group of entry points, when `ShardCompile` is enabled.
+	Groups []compileGroupResult `json:",omitempty"`
 }
 
-func Compile() (bool, string) {
+// Compiles all entry points matching the `Precompile` globs of the given `config`.
+func Compile(config *types.ConfigT) (bool, string) {
 	// Check if Precompile is empty
-	if len(types.Config.Precompile) == 0 {
+	if len(config.Precompile) == 0 {
 		return compileError(
 			"No precompile paths specified",
 			"The `precompile` configuration option must be an array, and specify at least one path or glob path to compile.",
 		)
 	}
 
-	// Delete old compiled assets.
-	os.RemoveAll(path.Join(types.Config.RootPath, types.Config.OutputDir))
+	// Delete old compiled assets, unless they are to be retained, in which case they are pruned after
+	// the build.
+	if config.RetainManifests == 0 {
+		os.RemoveAll(path.Join(config.RootPath, config.OutputDir))
+	}
 
 	_, err := replacements.Build()
 	if err != nil {
 		return compileError("build npm replacements", err.Error())
 	}
 
-	minify := !types.Config.InternalTesting && !types.Config.Debug && types.Config.Environment != types.DevEnv
+	var compiled compileResult
+
+	results, groups, err := compileResults(config)
+	if err != nil {
+		return compileError("Invalid build options", err.Error())
+	}
+	compiled.Groups = groups
+
+	var legacyResults []esbuild.BuildResult
+	if len(config.LegacyTargets) > 0 {
+		legacyResults, groups, err = compileResults(legacyConfig(config))
+		if err != nil {
+			return compileError("Invalid legacy build options", err.Error())
+		}
+
+		for _, group := range groups {
+			group.Name = "legacy:" + group.Name
+			compiled.Groups = append(compiled.Groups, group)
+		}
+	}
+
+	for _, result := range append(results, legacyResults...) {
+		compiled.Errors = append(compiled.Errors, result.Errors...)
+		compiled.Warnings = append(compiled.Warnings, result.Warnings...)
+	}
+
+	messages, err := json.Marshal(compiled)
+	if err != nil {
+		return false, string(err.Error())
+	}
+
+	if len(compiled.Errors) != 0 {
+		return false, string(messages)
+	}
+
+	manifest, err := buildManifest(config, results...)
+	if err != nil {
+		return compileError("Failed to build manifest", err.Error())
+	}
+
+	if len(legacyResults) > 0 {
+		if manifest.Legacy, err = buildManifest(config, legacyResults...); err != nil {
+			return compileError("Failed to build legacy manifest", err.Error())
+		}
+	}
+
+	if err := writeManifest(config, manifest); err != nil {
+		return compileError("Failed to write manifest", err.Error())
+	}
+
+	if config.RetainManifests > 0 {
+		if err := retainOutputs(config, manifest); err != nil {
+			return compileError("Failed to prune old assets", err.Error())
+		}
+	}
+
+	return true, string(messages)
+}
+
+// Builds the entry points of the given `config`, returning the result of each build, and of each
+// shard group when `ShardCompile` is set.
+func compileResults(config *types.ConfigT) ([]esbuild.BuildResult, []compileGroupResult, error) {
+	if config.ShardCompile {
+		return compileShards(config)
+	}
+
+	buildOptions, err := compileOptions(config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return []esbuild.BuildResult{esbuild.Build(buildOptions)}, nil, nil
+}
+
+// Returns a copy of the given `config` that builds the legacy outputs to the "legacy" directory
+// within the output dir, targeting the `LegacyTargets`.
+func legacyConfig(config *types.ConfigT) *types.ConfigT {
+	legacy := *config
+	legacy.OutputDir = path.Join(config.OutputDir, legacyOutputDir)
+	legacy.Targets = config.LegacyTargets
+	legacy.EnvironmentTargets = nil
+	legacy.LegacyTargets = nil
+
+	return &legacy
+}
+
+// Returns the build options used to compile the entry points of the given `config`.
+func compileOptions(config *types.ConfigT) (esbuild.BuildOptions, error) {
+	minify := !config.InternalTesting && !config.Debug && config.Environment != types.DevEnv
 
 	logLevel := esbuild.LogLevelInfo
-	if types.Config.Debug {
+	if config.Debug {
 		logLevel = esbuild.LogLevelDebug
 	}
 
 	buildOptions := esbuild.BuildOptions{
-		EntryPoints:                 types.Config.Precompile,
-		Splitting:                   types.Config.CodeSplitting,
-		AbsWorkingDir:               types.Config.RootPath,
+		EntryPoints:                 config.Precompile,
+		Splitting:                   config.CodeSplitting,
+		AbsWorkingDir:               config.RootPath,
 		AbsPaths:                    esbuild.MetafileAbsPath,
 		LogLevel:                    logLevel,
-		Outdir:                      types.Config.OutputDir,
+		Outdir:                      config.OutputDir,
 		Outbase:                     "./",
 		EntryNames:                  "[dir]/[name]-$[hash]$",
 		AssetNames:                  "[dir]/[name]-$[hash]$",
 		ChunkNames:                  "_asset_chunks/[name]-$[hash]$",
 		Format:                      esbuild.FormatESModule,
 		JSX:                         esbuild.JSXAutomatic,
-		JSXDev:                      types.Config.Environment != types.TestEnv && types.Config.Environment != types.ProdEnv,
+		JSXDev:                      config.Environment != types.TestEnv && config.Environment != types.ProdEnv,
 		MinifyWhitespace:            minify,
 		MinifyIdentifiers:           minify,
 		MinifySyntax:                minify,
 		DeterministicLocalCSSNaming: true,
 		Bundle:                      true,
-		Conditions:                  []string{types.Config.Environment.String(), "proscenium"},
+		Conditions:                  []string{config.Environment.String(), "proscenium"},
 		Write:                       true,
 		Sourcemap:                   esbuild.SourceMapLinked,
 		LegalComments:               esbuild.LegalCommentsNone,
-		Target:                      esbuild.ES2022,
 		Metafile:                    true,
 
-		Supported: map[string]bool{
-			// Ensure CSS nesting is transformed for browsers that don't support it.
-			"nesting": false,
-		},
-
 		// The Esbuild default places browser before module, but we're building for modern browsers
 		// which support esm. So we prioritise that. Some libraries export a "browser" build that still
 		// uses CJS.
 		MainFields: []string{"module", "browser", "main"},
 	}
 
-	buildOptions.Plugins = []esbuild.Plugin{
+	if err := utils.ApplyTargets(config, &buildOptions); err != nil {
+		return buildOptions, err
+	}
+
+	if err := utils.ApplyLoaders(config, &buildOptions); err != nil {
+		return buildOptions, err
+	}
+
+	registered, err := plugin.Registered(config)
+	if err != nil {
+		return buildOptions, err
+	}
+
+	buildOptions.Plugins = append(registered,
 		plugin.Http,
-		plugin.I18n,
+		plugin.I18n(config),
 		plugin.Rjs(),
-	}
+	)
 
-	if types.Config.Bundle {
-		buildOptions.External = types.Config.External
-		buildOptions.Plugins = append(buildOptions.Plugins, plugin.Bundler)
+	if config.Bundle {
+		buildOptions.External = config.External
+		buildOptions.Plugins = append(buildOptions.Plugins, plugin.Bundler(config))
 	} else {
 		buildOptions.PreserveSymlinks = true
-		buildOptions.Plugins = append(buildOptions.Plugins, plugin.Bundless)
+		buildOptions.Plugins = append(buildOptions.Plugins, plugin.Bundless(config))
 	}
 
-	buildOptions.Plugins = append(buildOptions.Plugins, plugin.Replacements, plugin.Svg, plugin.Css, plugin.Dirname)
+	buildOptions.Plugins = append(buildOptions.Plugins, plugin.Replacements, plugin.Svg, plugin.Css(config), plugin.Dirname(config))
 
-	definitions, err := buildEnvVars()
+	definitions, err := buildEnvVars(config)
 	if err != nil {
-		return compileError("Failed to parse environment variables", err.Error())
+		return buildOptions, err
 	}
 
 	buildOptions.Define = definitions
 	buildOptions.Define["proscenium.env.PRECOMPILED"] = "true"
 	buildOptions.Define["global"] = "window"
 
-	result := esbuild.Build(buildOptions)
-
-	messages, err := json.Marshal(compileResult{
-		Errors:   result.Errors,
-		Warnings: result.Warnings,
-	})
-	if err != nil {
-		return false, string(err.Error())
-	}
-
-	if len(result.Errors) != 0 {
-		return false, string(messages)
-	}
-
-	os.WriteFile(path.Join(types.Config.RootPath, types.Config.OutputDir, ".manifest.json"), []byte(result.Metafile), 0644)
-
-	return true, string(messages)
+	return buildOptions, nil
 }
 
 func compileError(msg string, detail string) (bool, string) {
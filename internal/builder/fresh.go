@@ -0,0 +1,131 @@
+package builder
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"joelmoss/proscenium/internal/types"
+	"slices"
+	"sync"
+)
+
+// The ETag of the last build of a path, and the stamps of the inputs it was derived from.
+type freshness struct {
+	etag   string
+	stamps map[string]fileStamp
+
+	// When the record was last used, relative to other records, so that the least recently used is
+	// evicted first.
+	lastUsed uint64
+}
+
+// Keyed by the hash of the config and the built path.
+var (
+	freshnessMutex   sync.Mutex
+	freshnessRecords = map[string]*freshness{}
+	freshnessClock   uint64
+)
+
+func freshnessKey(config *types.ConfigT, filePath string) string {
+	return config.Hash() + "|" + filePath
+}
+
+// Derives a strong ETag for the build of `filePath` from the config, and the content hashes in the
+// given `stamps` of every input of the build, and records it along with the stamps. Returns the
+// ETag, or an empty string if `stamps` is nil, as when any input is a virtual module, whose contents
+// cannot be checked.
+func recordFreshness(config *types.ConfigT, filePath string, stamps map[string]fileStamp) string {
+	key := freshnessKey(config, filePath)
+
+	freshnessMutex.Lock()
+	defer freshnessMutex.Unlock()
+
+	if stamps == nil {
+		delete(freshnessRecords, key)
+		return ""
+	}
+
+	etag := etagOf(key, stamps)
+	freshnessClock++
+	freshnessRecords[key] = &freshness{etag: etag, stamps: stamps, lastUsed: freshnessClock}
+	evictFreshness(config)
+
+	return etag
+}
+
+// Removes the least recently used records until no more than the `IncrementalLimit` of the given
+// `config` remain. Must be called with `freshnessMutex` locked.
+func evictFreshness(config *types.ConfigT) {
+	limit := config.IncrementalLimit
+	if limit <= 0 {
+		limit = defaultIncrementalLimit
+	}
+
+	for len(freshnessRecords) > limit {
+		var oldestKey string
+		var oldest *freshness
+		for key, record := range freshnessRecords {
+			if oldest == nil || record.lastUsed < oldest.lastUsed {
+				oldestKey, oldest = key, record
+			}
+		}
+
+		delete(freshnessRecords, oldestKey)
+	}
+}
+
+func etagOf(key string, stamps map[string]fileStamp) string {
+	paths := make([]string, 0, len(stamps))
+	for path, stamp := range stamps {
+		// Directories are only stamped to detect added or removed files.
+		if !stamp.isDir {
+			paths = append(paths, path)
+		}
+	}
+	slices.Sort(paths)
+
+	h := sha256.New()
+	h.Write([]byte(key))
+	for _, path := range paths {
+		h.Write([]byte{0})
+		h.Write([]byte(path))
+		h.Write(stamps[path].hash)
+	}
+
+	return `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+}
+
+// Returns true if the given `etag` is that of the last build of `filePath` with the given `config`,
+// and none of its inputs have changed since. Does not build anything, so is cheap enough to answer
+// conditional requests with.
+func CheckFresh(config *types.ConfigT, filePath string, etag string) bool {
+	if etag == "" {
+		return false
+	}
+
+	freshnessMutex.Lock()
+	defer freshnessMutex.Unlock()
+
+	key := freshnessKey(config, filePath)
+	record, ok := freshnessRecords[key]
+	if !ok || record.etag != etag {
+		return false
+	}
+
+	if stampsChanged(record.stamps) {
+		delete(freshnessRecords, key)
+		return false
+	}
+
+	freshnessClock++
+	record.lastUsed = freshnessClock
+
+	return true
+}
+
+// Forgets the ETags of all builds.
+func ResetFreshness() {
+	freshnessMutex.Lock()
+	defer freshnessMutex.Unlock()
+
+	clear(freshnessRecords)
+}
@@ -0,0 +1,140 @@
+package builder
+
+import (
+	"encoding/json"
+	"fmt"
+	"joelmoss/proscenium/internal/types"
+	"joelmoss/proscenium/internal/utils"
+	"path"
+	"path/filepath"
+)
+
+// The dependencies of an entry point, as URL paths. Suitable for rendering
+// `<link rel="modulepreload">` and stylesheet tags.
+type DependencyGraphT struct {
+	// URL path of the entry point.
+	File string `json:"file"`
+
+	// URL paths of the chunks and unbundled modules that the entry point statically imports,
+	// including those imported by its chunks, in the order they are imported.
+	Imports []string `json:"imports"`
+
+	// URL paths of the chunks and unbundled modules dynamically imported by the entry point, or by
+	// any of its static imports.
+	DynamicImports []string `json:"dynamicImports"`
+
+	// URL paths of the stylesheets of the entry point, and those imported by it.
+	Css []string `json:"css"`
+}
+
+// Returns the dependency graph of the given `filePath`, derived from the metafile of the same build
+// as `BuildToString`. The `filePath` should be a URL path, but without the leading slash, and its
+// output is found the same way as `BuildToString` finds it, so that entry points within Ruby gems
+// are also supported.
+//
+// Unbundled imports are external to the build, and so are included, but not followed.
+func DependencyGraph(config *types.ConfigT, filePath string) (*DependencyGraphT, error) {
+	result := build(config, filePath)
+	if len(result.Errors) != 0 {
+		return nil, fmt.Errorf("%s", result.Errors[0].Text)
+	}
+
+	var metadata struct {
+		Outputs map[string]metafileOutput `json:"outputs"`
+	}
+	if err := json.Unmarshal([]byte(result.Metafile), &metadata); err != nil {
+		return nil, err
+	}
+
+	entryOutput, err := findEntryOutput(config, filePath, result)
+	if err != nil {
+		return nil, err
+	}
+
+	var entryPath string
+	for outputPath := range metadata.Outputs {
+		if absOutputPath(config, outputPath) == entryOutput.Path {
+			entryPath = outputPath
+			break
+		}
+	}
+	if entryPath == "" {
+		return nil, fmt.Errorf("Could not find output file.")
+	}
+
+	graph := &DependencyGraphT{
+		File:           "/" + filePath,
+		Imports:        []string{},
+		DynamicImports: []string{},
+		Css:            []string{},
+	}
+
+	seen := map[string]bool{}
+	add := func(list *[]string, urlPath string) {
+		if !seen[urlPath] {
+			seen[urlPath] = true
+			*list = append(*list, urlPath)
+		}
+	}
+
+	// Walk the static imports breadth first, so that dependencies are listed in the order imported.
+	visited := map[string]bool{entryPath: true}
+	queue := []string{entryPath}
+	for len(queue) > 0 {
+		outputPath := queue[0]
+		output := metadata.Outputs[outputPath]
+		queue = queue[1:]
+
+		if output.CssBundle != "" {
+			add(&graph.Css, graphUrlPath(config, output.CssBundle))
+		}
+
+		for _, imp := range output.Imports {
+			var urlPath string
+			if imp.External {
+				// Unbundled imports are already URL paths.
+				if !path.IsAbs(imp.Path) && !utils.IsUrl(imp.Path) {
+					continue
+				}
+				urlPath = imp.Path
+			} else {
+				urlPath = graphUrlPath(config, imp.Path)
+			}
+
+			switch {
+			case imp.Kind == "import-rule" || utils.PathIsCss(imp.Path):
+				add(&graph.Css, urlPath)
+			case imp.Kind == "dynamic-import":
+				add(&graph.DynamicImports, urlPath)
+			case imp.Kind == "import-statement":
+				add(&graph.Imports, urlPath)
+
+				if !imp.External && !visited[imp.Path] {
+					visited[imp.Path] = true
+					queue = append(queue, imp.Path)
+				}
+			}
+		}
+	}
+
+	return graph, nil
+}
+
+// Returns the absolute path of the given `outputPath` of a build, which may be relative to the root.
+func absOutputPath(config *types.ConfigT, outputPath string) string {
+	if filepath.IsAbs(outputPath) {
+		return outputPath
+	}
+
+	return path.Join(config.RootPath, outputPath)
+}
+
+// Returns the URL path of the given `outputPath` of a build, which is relative to the output dir.
+func graphUrlPath(config *types.ConfigT, outputPath string) string {
+	relPath, err := filepath.Rel(path.Join(config.RootPath, config.OutputDir), absOutputPath(config, outputPath))
+	if err != nil {
+		return outputPath
+	}
+
+	return "/" + filepath.ToSlash(relPath)
+}
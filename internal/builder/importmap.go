@@ -0,0 +1,24 @@
+package builder
+
+import (
+	"encoding/json"
+	"fmt"
+	"joelmoss/proscenium/internal/plugin"
+	"joelmoss/proscenium/internal/types"
+)
+
+// Returns the JSON encoded import map of the given `config`, which maps each dependency in the
+// app's package.json to its URL path, so that bare specifiers can be left intact by unbundled
+// builds.
+func ImportMap(config *types.ConfigT) (string, error) {
+	if config.Bundle || !config.ImportMap {
+		return "", fmt.Errorf("Import maps require the `ImportMap` option, and `Bundle` to be false")
+	}
+
+	j, err := json.Marshal(plugin.ImportMap(config))
+	if err != nil {
+		return "", err
+	}
+
+	return string(j), nil
+}
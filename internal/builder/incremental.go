@@ -0,0 +1,365 @@
+package builder
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"io"
+	"joelmoss/proscenium/internal/debug"
+	"joelmoss/proscenium/internal/plugin"
+	"joelmoss/proscenium/internal/types"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	esbuild "github.com/joelmoss/esbuild-internal/api"
+)
+
+// An esbuild context that is kept alive between builds of the same entry point, so that esbuild
+// can reuse the ASTs of files that have not changed.
+type incrementalContext struct {
+	mutex sync.Mutex
+	ctx   esbuild.BuildContext
+
+	// The result of the last successful build.
+	result *esbuild.BuildResult
+
+	// Stamps of every file and directory that the last build depended on, keyed by absolute path.
+	// Nil when the build has inputs that cannot be checked, such as virtual modules.
+	stamps map[string]fileStamp
+
+	// When the context was last used, relative to other contexts, so that the least recently used
+	// is evicted first.
+	lastUsed uint64
+
+	// Whether the context was disposed after being evicted.
+	disposed bool
+}
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+	isDir   bool
+	hash    []byte
+}
+
+// The number of incremental contexts kept alive when `IncrementalLimit` is not set.
+const defaultIncrementalLimit = 100
+
+var (
+	incrementalMutex    sync.Mutex
+	incrementalContexts = map[string]*incrementalContext{}
+	incrementalClock    uint64
+)
+
+// The stamp of a file hashed by `stampPaths`, and the stamping that last included it.
+type hashedFile struct {
+	stamp    fileStamp
+	lastUsed uint64
+}
+
+// Files hashed by `stampPaths`, keyed by absolute path, so that a file is only hashed again once its
+// modification time or size has changed, however many builds depend on it. Files that none of the
+// last `IncrementalLimit` stampings included are forgotten.
+var (
+	hashedFilesMutex sync.Mutex
+	hashedFiles      = map[string]*hashedFile{}
+	hashedFilesClock uint64
+)
+
+// Builds the given `entryPoint` with an esbuild context that is reused between calls with the same
+// entry point and config. If none of the files that the last build depended on have changed since,
+// then the last result is returned without building at all.
+func buildIncrementally(config *types.ConfigT, entryPoint string, options esbuild.BuildOptions) esbuild.BuildResult {
+	key := entryPoint + "|" + config.Hash()
+
+	incrementalMutex.Lock()
+	ic, ok := incrementalContexts[key]
+	if !ok {
+		ctx, err := esbuild.Context(options)
+		if err != nil {
+			incrementalMutex.Unlock()
+			return esbuild.BuildResult{Errors: err.Errors}
+		}
+
+		ic = &incrementalContext{ctx: ctx}
+		incrementalContexts[key] = ic
+	}
+	incrementalClock++
+	ic.lastUsed = incrementalClock
+	evicted := evictIncremental(config)
+	incrementalMutex.Unlock()
+
+	for _, e := range evicted {
+		e.dispose()
+	}
+
+	ic.mutex.Lock()
+
+	// The context may have been evicted and disposed while waiting for the lock.
+	if ic.disposed {
+		ic.mutex.Unlock()
+		return buildIncrementally(config, entryPoint, options)
+	}
+
+	defer ic.mutex.Unlock()
+
+	if ic.result != nil && ic.stamps != nil && !stampsChanged(ic.stamps) {
+		debug.Debug("buildIncrementally:fresh", key)
+		return *ic.result
+	}
+
+	result := ic.ctx.Rebuild()
+	if len(result.Errors) == 0 {
+		ic.result = &result
+		ic.stamps = stampInputs(config, result.Metafile)
+	} else {
+		ic.result = nil
+		ic.stamps = nil
+	}
+
+	return result
+}
+
+// Removes the least recently used contexts until no more than the `IncrementalLimit` of the given
+// `config` remain, and returns them so that they can be disposed once `incrementalMutex` is
+// released. Must be called with `incrementalMutex` locked.
+func evictIncremental(config *types.ConfigT) []*incrementalContext {
+	limit := config.IncrementalLimit
+	if limit <= 0 {
+		limit = defaultIncrementalLimit
+	}
+
+	var evicted []*incrementalContext
+	for len(incrementalContexts) > limit {
+		var oldestKey string
+		var oldest *incrementalContext
+		for key, ic := range incrementalContexts {
+			if oldest == nil || ic.lastUsed < oldest.lastUsed {
+				oldestKey, oldest = key, ic
+			}
+		}
+
+		debug.Debug("buildIncrementally:evict", oldestKey)
+		delete(incrementalContexts, oldestKey)
+		evicted = append(evicted, oldest)
+	}
+
+	return evicted
+}
+
+// Disposes of the esbuild context, waiting for any build using it to finish.
+func (ic *incrementalContext) dispose() {
+	ic.mutex.Lock()
+	defer ic.mutex.Unlock()
+
+	ic.ctx.Dispose()
+	ic.disposed = true
+	ic.result = nil
+	ic.stamps = nil
+}
+
+// Disposes of all incremental build contexts.
+func DisposeIncremental() {
+	incrementalMutex.Lock()
+	evicted := make([]*incrementalContext, 0, len(incrementalContexts))
+	for key, ic := range incrementalContexts {
+		evicted = append(evicted, ic)
+		delete(incrementalContexts, key)
+	}
+	incrementalMutex.Unlock()
+
+	for _, ic := range evicted {
+		ic.dispose()
+	}
+}
+
+// Returns the number of incremental build contexts that are kept alive.
+func IncrementalContexts() int {
+	incrementalMutex.Lock()
+	defer incrementalMutex.Unlock()
+
+	return len(incrementalContexts)
+}
+
+// Stamps each input in the given `metafile`, along with the files they depend on and the
+// directories containing them, so that added or removed files are also detected. Returns nil if any
+// input is a virtual module, as they cannot be checked for changes.
+func stampInputs(config *types.ConfigT, metafile string) map[string]fileStamp {
+	paths, hasVirtual, ok := metafileInputPaths(config.RootPath, metafile)
+	if !ok || hasVirtual {
+		return nil
+	}
+
+	return stampPaths(config, paths)
+}
+
+// Returns the absolute paths of each input in the given `metafile`, along with the files they
+// depend on and the directories containing them. Virtual modules are skipped, and `hasVirtual` is
+// true if there were any.
+func metafileInputPaths(root string, metafile string) (paths []string, hasVirtual bool, ok bool) {
+	var metadata struct{ Inputs map[string]any }
+	if err := json.Unmarshal([]byte(metafile), &metadata); err != nil {
+		return nil, false, false
+	}
+
+	seen := make(map[string]bool, len(metadata.Inputs)*2)
+	add := func(path string) {
+		for _, p := range []string{path, filepath.Dir(path)} {
+			if !seen[p] {
+				seen[p] = true
+				paths = append(paths, p)
+			}
+		}
+	}
+
+	for input := range metadata.Inputs {
+		// Inputs from namespaces other than "file" are prefixed with the namespace.
+		if ns, _, found := strings.Cut(input, ":"); found && !strings.Contains(ns, "/") {
+			hasVirtual = true
+			continue
+		}
+
+		path := input
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(root, path)
+		}
+
+		add(path)
+		for _, dep := range plugin.FileDependencies(path) {
+			add(dep)
+		}
+	}
+
+	return paths, hasVirtual, true
+}
+
+// Stamps each of the given `paths`. Returns nil if any of them cannot be stamped.
+func stampPaths(config *types.ConfigT, paths []string) map[string]fileStamp {
+	hashedFilesMutex.Lock()
+	hashedFilesClock++
+	clock := hashedFilesClock
+	hashedFilesMutex.Unlock()
+
+	defer evictHashedFiles(config)
+
+	stamps := make(map[string]fileStamp, len(paths))
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil
+		}
+
+		s := fileStamp{modTime: info.ModTime(), size: info.Size(), isDir: info.IsDir()}
+		if !s.isDir {
+			if s.hash, err = hashStampedFile(path, s, clock); err != nil {
+				return nil
+			}
+		}
+
+		stamps[path] = s
+	}
+
+	return stamps
+}
+
+// Returns the content hash of the file at `path`, reusing that of the last time it was hashed if
+// its modification time and size are still those of the given `stamp`. The `clock` is that of the
+// stamping that the file is included in.
+func hashStampedFile(path string, stamp fileStamp, clock uint64) ([]byte, error) {
+	hashedFilesMutex.Lock()
+	hashed, ok := hashedFiles[path]
+	if ok && hashed.stamp.modTime.Equal(stamp.modTime) && hashed.stamp.size == stamp.size {
+		hashed.lastUsed = max(hashed.lastUsed, clock)
+		hashedFilesMutex.Unlock()
+		return hashed.stamp.hash, nil
+	}
+	hashedFilesMutex.Unlock()
+
+	hash, err := hashFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	stamp.hash = hash
+
+	hashedFilesMutex.Lock()
+	hashedFiles[path] = &hashedFile{stamp: stamp, lastUsed: clock}
+	hashedFilesMutex.Unlock()
+
+	return hash, nil
+}
+
+// Forgets the hashes of files that none of the last `IncrementalLimit` stampings of the given
+// `config` included.
+func evictHashedFiles(config *types.ConfigT) {
+	limit := config.IncrementalLimit
+	if limit <= 0 {
+		limit = defaultIncrementalLimit
+	}
+
+	hashedFilesMutex.Lock()
+	defer hashedFilesMutex.Unlock()
+
+	for path, hashed := range hashedFiles {
+		if hashedFilesClock-hashed.lastUsed >= uint64(limit) {
+			delete(hashedFiles, path)
+		}
+	}
+}
+
+// Returns the number of files whose content hashes are kept.
+func HashedFiles() int {
+	hashedFilesMutex.Lock()
+	defer hashedFilesMutex.Unlock()
+
+	return len(hashedFiles)
+}
+
+// Returns true if any of the given `stamps` no longer match the file system. Files with a changed
+// modification time, but unchanged size, are compared by content hash, so that touching a file does
+// not trigger a rebuild.
+func stampsChanged(stamps map[string]fileStamp) bool {
+	for path, stamp := range stamps {
+		info, err := os.Stat(path)
+		if err != nil || (!stamp.isDir && info.Size() != stamp.size) {
+			return true
+		}
+
+		if info.ModTime().Equal(stamp.modTime) {
+			continue
+		}
+
+		if stamp.isDir {
+			return true
+		}
+
+		hash, err := hashFile(path)
+		if err != nil || !bytes.Equal(hash, stamp.hash) {
+			return true
+		}
+
+		stamp.modTime = info.ModTime()
+		stamps[path] = stamp
+	}
+
+	return false
+}
+
+func hashFile(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+
+	return h.Sum(nil), nil
+}
@@ -0,0 +1,205 @@
+package builder
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"joelmoss/proscenium/internal/types"
+	"joelmoss/proscenium/internal/utils"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	esbuild "github.com/joelmoss/esbuild-internal/api"
+)
+
+const manifestVersion = 1
+
+// The manifest written to `.manifest.json` by `Compile`. It maps the logical path of each entry
+// point to its hashed output, so that servers can render tags without understanding the esbuild
+// metafile.
+type Manifest struct {
+	Version int `json:"version"`
+
+	// Keyed by the logical path of each entry point, which is its path relative to the root with a
+	// leading slash, or "@rubygems/<gem name>/<path>" for entry points within a Ruby gem.
+	Entries map[string]ManifestEntry `json:"entries"`
+
+	// Every output file except source maps, keyed by URL path.
+	Files map[string]ManifestFile `json:"files"`
+
+	// The manifest of the outputs compiled for the `LegacyTargets`, if any.
+	Legacy *Manifest `json:"legacy,omitempty"`
+}
+
+type ManifestEntry struct {
+	// URL path of the hashed output of the entry point.
+	File string `json:"file"`
+
+	// URL paths of the chunks that the entry point statically imports, including those imported by
+	// its chunks, in the order they are imported. Suitable for `<link rel=modulepreload>`.
+	Imports []string `json:"imports,omitempty"`
+
+	// URL paths of the stylesheets imported by a JavaScript entry point.
+	Css []string `json:"css,omitempty"`
+}
+
+type ManifestFile struct {
+	Integrity string `json:"integrity"`
+	Size      int    `json:"size"`
+}
+
+type metafileOutput struct {
+	EntryPoint string `json:"entryPoint"`
+	CssBundle  string `json:"cssBundle"`
+	Imports    []struct {
+		Path     string `json:"path"`
+		Kind     string `json:"kind"`
+		External bool   `json:"external"`
+	} `json:"imports"`
+}
+
+// Builds the manifest of the given compile `results`, which must include their metafiles. The
+// contents of each output are taken from the results, or read from disk if the results do not
+// include them.
+func buildManifest(config *types.ConfigT, results ...esbuild.BuildResult) (*Manifest, error) {
+	outputs := map[string]metafileOutput{}
+	contents := map[string][]byte{}
+
+	for _, result := range results {
+		var metadata struct {
+			Outputs map[string]metafileOutput `json:"outputs"`
+		}
+		if err := json.Unmarshal([]byte(result.Metafile), &metadata); err != nil {
+			return nil, err
+		}
+
+		// Chunks shared between results have the same path, and so are only included once.
+		maps.Copy(outputs, metadata.Outputs)
+
+		for _, output := range result.OutputFiles {
+			contents[output.Path] = output.Contents
+		}
+	}
+
+	manifest := &Manifest{
+		Version: manifestVersion,
+		Entries: map[string]ManifestEntry{},
+		Files:   map[string]ManifestFile{},
+	}
+
+	absPath := func(outputPath string) string {
+		if filepath.IsAbs(outputPath) {
+			return outputPath
+		}
+		return path.Join(config.RootPath, outputPath)
+	}
+
+	for outputPath := range outputs {
+		if strings.HasSuffix(outputPath, ".map") {
+			continue
+		}
+
+		outputPath = absPath(outputPath)
+
+		data, ok := contents[outputPath]
+		if !ok {
+			var err error
+			if data, err = os.ReadFile(outputPath); err != nil {
+				return nil, err
+			}
+		}
+
+		manifest.Files[outputUrlPath(config, outputPath)] = ManifestFile{
+			Integrity: Integrity(config, data),
+			Size:      len(data),
+		}
+	}
+
+	for outputPath, output := range outputs {
+		if output.EntryPoint == "" || strings.HasSuffix(outputPath, ".map") {
+			continue
+		}
+
+		entry := ManifestEntry{File: outputUrlPath(config, absPath(outputPath))}
+
+		// Walk the static imports breadth first, so that chunks are listed in the order imported.
+		seen := map[string]bool{outputPath: true}
+		queue := []string{outputPath}
+		for len(queue) > 0 {
+			current := outputs[queue[0]]
+			queue = queue[1:]
+
+			for _, imp := range current.Imports {
+				if imp.External || imp.Kind != "import-statement" || seen[imp.Path] {
+					continue
+				}
+
+				seen[imp.Path] = true
+				queue = append(queue, imp.Path)
+				entry.Imports = append(entry.Imports, outputUrlPath(config, absPath(imp.Path)))
+			}
+		}
+
+		if output.CssBundle != "" {
+			entry.Css = []string{outputUrlPath(config, absPath(output.CssBundle))}
+		}
+
+		manifest.Entries[manifestEntryPath(config, absPath(output.EntryPoint))] = entry
+	}
+
+	return manifest, nil
+}
+
+// Writes the given `manifest` to `.manifest.json` in the output dir.
+func writeManifest(config *types.ConfigT, manifest *Manifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path.Join(config.RootPath, config.OutputDir, ".manifest.json"), data, 0644)
+}
+
+// Returns the logical path of the entry point at the given absolute `entryPoint`.
+func manifestEntryPath(config *types.ConfigT, entryPoint string) string {
+	if gemName, gemPath, found := utils.PathIsRubyGem(config, entryPoint); found {
+		return types.RubyGemsScope + gemName + strings.TrimPrefix(entryPoint, gemPath)
+	}
+
+	return strings.TrimPrefix(entryPoint, config.RootPath)
+}
+
+// Converts the absolute path of an output file to the URL path it is served from. Outputs are
+// always written to a directory within Rails' public directory, which is served from "/".
+func outputUrlPath(config *types.ConfigT, outputPath string) string {
+	relPath, err := filepath.Rel(config.RootPath, outputPath)
+	if err != nil {
+		return outputPath
+	}
+
+	return "/" + strings.TrimPrefix(filepath.ToSlash(relPath), "public/")
+}
+
+// Returns the Subresource Integrity string of the given `data`, using the `IntegrityAlgorithm` of
+// the given `config`, which defaults to sha384. Other algorithms are rejected by `ParseConfig`.
+func Integrity(config *types.ConfigT, data []byte) string {
+	var sum []byte
+
+	switch config.IntegrityAlgorithm {
+	case "sha256":
+		s := sha256.Sum256(data)
+		sum = s[:]
+	case "sha512":
+		s := sha512.Sum512(data)
+		sum = s[:]
+	default:
+		s := sha512.Sum384(data)
+		return "sha384-" + base64.StdEncoding.EncodeToString(s[:])
+	}
+
+	return config.IntegrityAlgorithm + "-" + base64.StdEncoding.EncodeToString(sum)
+}
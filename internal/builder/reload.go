@@ -0,0 +1,212 @@
+package builder
+
+import (
+	"encoding/json"
+	"fmt"
+	"joelmoss/proscenium/internal/utils"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// The files that each asset built with `BuildToString` depends on, keyed by the URL path of the
+// asset. Only recorded when `LiveReload` is enabled.
+var (
+	reloadMutex   sync.Mutex
+	reloadEntries = map[string]*reloadEntry{}
+	reloadBuilds  int
+)
+
+type reloadEntry struct {
+	stamps map[string]fileStamp
+
+	// Incremented for each build of the asset, so that each consumer of changes can tell whether it
+	// has already been given the current build.
+	build int
+
+	// Whether any of the files have changed since the asset was built, so that they are not checked
+	// again until it is rebuilt.
+	changed bool
+}
+
+// The build of each changed asset that a consumer of changes was last given, keyed by URL path.
+// Each consumer has its own cursor, so that they do not take changes from one another.
+type reloadCursor map[string]int
+
+var (
+	// The cursor of `ChangedAssets`.
+	changedAssetsCursor = reloadCursor{}
+
+	// The cursor of the poller of `LiveReloadHandler`, which is kept when the poller stops, so that
+	// clients that reconnect are not sent changes that were already sent.
+	pollCursor = reloadCursor{}
+)
+
+// A change to an asset, as sent by `LiveReloadHandler`.
+type ReloadEvent struct {
+	Path string `json:"path"`
+
+	// "css" if the asset is a stylesheet that can be swapped in place, otherwise "js", which
+	// requires a full page reload.
+	Type string `json:"type"`
+}
+
+// Records the given `stamps` of the inputs of a build as the dependencies of the asset at `urlPath`.
+// Virtual modules are not stamped, as only files on disk can change.
+func recordReloadInputs(urlPath string, stamps map[string]fileStamp) {
+	if stamps == nil {
+		return
+	}
+
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
+
+	reloadBuilds++
+	reloadEntries[urlPath] = &reloadEntry{stamps: stamps, build: reloadBuilds}
+}
+
+// Returns the sorted URL paths of each asset built since the last call, that depends on a file that
+// has since changed. Each asset is only returned once, until it is built again. Changes returned
+// here are still sent by `LiveReloadHandler`.
+func ChangedAssets() []string {
+	return changedAssets(changedAssetsCursor)
+}
+
+// Returns the sorted URL paths of each changed asset that has not yet been given to the consumer of
+// the given `cursor`.
+func changedAssets(cursor reloadCursor) []string {
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
+
+	changed := []string{}
+	for urlPath, entry := range reloadEntries {
+		if !entry.changed && !stampsChanged(entry.stamps) {
+			continue
+		}
+
+		entry.changed = true
+		if cursor[urlPath] != entry.build {
+			cursor[urlPath] = entry.build
+			changed = append(changed, urlPath)
+		}
+	}
+
+	slices.Sort(changed)
+	return changed
+}
+
+// Forgets the inputs of all recorded assets.
+func ResetLiveReload() {
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
+
+	clear(reloadEntries)
+	clear(changedAssetsCursor)
+	clear(pollCursor)
+}
+
+// Clients of `LiveReloadHandler`, which all receive the changes found by a single poller.
+var (
+	reloadSubscribersMutex sync.Mutex
+	reloadSubscribers      = map[chan []string]bool{}
+
+	// Whether the poller is running. It only stops on a tick without subscribers, so a client may
+	// subscribe after the last has unsubscribed, but before the poller has stopped.
+	reloadPolling bool
+)
+
+// Subscribes to changed assets, starting the poller if it is not already running. The returned
+// function unsubscribes, and the poller stops once there are no subscribers.
+func subscribeReload(interval time.Duration) (chan []string, func()) {
+	changes := make(chan []string, 16)
+
+	reloadSubscribersMutex.Lock()
+	if !reloadPolling {
+		reloadPolling = true
+		go pollReload(interval)
+	}
+	reloadSubscribers[changes] = true
+	reloadSubscribersMutex.Unlock()
+
+	return changes, func() {
+		reloadSubscribersMutex.Lock()
+		defer reloadSubscribersMutex.Unlock()
+
+		delete(reloadSubscribers, changes)
+	}
+}
+
+func pollReload(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		reloadSubscribersMutex.Lock()
+		if len(reloadSubscribers) == 0 {
+			reloadPolling = false
+			reloadSubscribersMutex.Unlock()
+			return
+		}
+
+		// Changes are only taken while there are subscribers to send them to.
+		if changed := changedAssets(pollCursor); len(changed) > 0 {
+			for subscriber := range reloadSubscribers {
+				select {
+				case subscriber <- changed:
+				default:
+					// Skip slow clients rather than block the others.
+				}
+			}
+		}
+		reloadSubscribersMutex.Unlock()
+	}
+}
+
+// Returns an HTTP handler that streams a `change` server-sent event for each changed asset, checking
+// for changes every `interval`. Stylesheets can be swapped in place by the client, while any other
+// change should reload the page.
+func LiveReloadHandler(interval time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+			return
+		}
+
+		header := w.Header()
+		header.Set("Content-Type", "text/event-stream")
+		header.Set("Cache-Control", "no-cache")
+		header.Set("Connection", "keep-alive")
+		header.Set("Access-Control-Allow-Origin", "*")
+
+		changes, unsubscribe := subscribeReload(interval)
+		defer unsubscribe()
+
+		fmt.Fprint(w, ": connected\n\n")
+		flusher.Flush()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case changed := <-changes:
+				for _, urlPath := range changed {
+					event := ReloadEvent{Path: urlPath, Type: "js"}
+					if utils.PathIsCss(urlPath) {
+						event.Type = "css"
+					}
+
+					data, err := json.Marshal(event)
+					if err != nil {
+						continue
+					}
+
+					fmt.Fprintf(w, "event: change\ndata: %s\n\n", data)
+				}
+
+				flusher.Flush()
+			}
+		}
+	})
+}
@@ -0,0 +1,130 @@
+package builder
+
+import (
+	"encoding/json"
+	"io/fs"
+	"joelmoss/proscenium/internal/types"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Directory within the output dir where the manifest of each compile is archived, when
+// `RetainManifests` is set.
+const manifestArchiveDir = ".manifests"
+
+// Archives the given `manifest` of the current compile, and then removes all outputs that are not
+// referenced by it, or by any of the previous `RetainManifests` archived manifests. Older archived
+// manifests are also removed.
+func retainOutputs(config *types.ConfigT, manifest *Manifest) error {
+	outputDir := path.Join(config.RootPath, config.OutputDir)
+	archiveDir := path.Join(outputDir, manifestArchiveDir)
+
+	if err := os.MkdirAll(archiveDir, 0755); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+
+	// Names sort in the order they were compiled.
+	name := time.Now().UTC().Format("20060102T150405.000000000") + ".json"
+	if err := os.WriteFile(path.Join(archiveDir, name), data, 0644); err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(archiveDir)
+	if err != nil {
+		return err
+	}
+
+	var archived []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".json") {
+			archived = append(archived, entry.Name())
+		}
+	}
+	slices.Sort(archived)
+
+	// The current manifest, and the previous `RetainManifests`.
+	retainFrom := max(len(archived)-config.RetainManifests-1, 0)
+	for _, name := range archived[:retainFrom] {
+		os.Remove(path.Join(archiveDir, name))
+	}
+
+	referenced := map[string]bool{}
+	for _, name := range archived[retainFrom:] {
+		data, err := os.ReadFile(path.Join(archiveDir, name))
+		if err != nil {
+			return err
+		}
+
+		var retained Manifest
+		if err := json.Unmarshal(data, &retained); err != nil || retained.Version != manifestVersion {
+			// Unreadable manifests cannot be retained, so their outputs are removed.
+			continue
+		}
+
+		for urlPath := range retained.Files {
+			referenced[urlPath] = true
+		}
+		if retained.Legacy != nil {
+			for urlPath := range retained.Legacy.Files {
+				referenced[urlPath] = true
+			}
+		}
+	}
+
+	return pruneOutputs(config, outputDir, referenced)
+}
+
+// Removes every file in the `outputDir` whose URL path is not `referenced`, along with any
+// directories left empty. Source maps are kept as long as their output is referenced.
+func pruneOutputs(config *types.ConfigT, outputDir string, referenced map[string]bool) error {
+	var dirs []string
+
+	err := filepath.WalkDir(outputDir, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() {
+			if entry.Name() == manifestArchiveDir {
+				return filepath.SkipDir
+			}
+			if filePath != outputDir {
+				dirs = append(dirs, filePath)
+			}
+			return nil
+		}
+
+		if filepath.Dir(filePath) == outputDir && strings.HasPrefix(entry.Name(), ".manifest") {
+			return nil
+		}
+
+		urlPath := strings.TrimSuffix(outputUrlPath(config, filePath), ".map")
+		if !referenced[urlPath] {
+			return os.Remove(filePath)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Remove the deepest directories first, so that their parents can then be removed if empty.
+	slices.Reverse(dirs)
+	for _, dir := range dirs {
+		if entries, err := os.ReadDir(dir); err == nil && len(entries) == 0 {
+			os.Remove(dir)
+		}
+	}
+
+	return nil
+}
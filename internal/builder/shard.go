@@ -0,0 +1,167 @@
+package builder
+
+import (
+	"joelmoss/proscenium/internal/types"
+	"joelmoss/proscenium/internal/utils"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	esbuild "github.com/joelmoss/esbuild-internal/api"
+)
+
+// The result of compiling a single group of entry points.
+type compileGroupResult struct {
+	Name       string
+	Precompile []string
+	Duration   int64 // Milliseconds
+	Errors     []esbuild.Message
+	Warnings   []esbuild.Message
+}
+
+// Partitions the `Precompile` globs of the given `config` into groups, and builds each group
+// concurrently, at most `CompileConcurrency` at a time. Each group is built in full, even if others
+// fail, so that the errors of every group are reported.
+//
+// Each group is a separate build, so code is never split between groups, and a module imported by
+// entry points of more than one group is bundled into each of them. A page that loads entry points
+// of different groups will therefore load more than one instance of such a module, each with its
+// own state. All groups share the same chunk directory, and as chunks are named by their content
+// hash, a chunk emitted by more than one group has the same path and contents in each. Outputs are
+// written by `shardOutputs`, so that each is only written once, and never concurrently.
+func compileShards(config *types.ConfigT) ([]esbuild.BuildResult, []compileGroupResult, error) {
+	names, patterns := precompileGroups(config)
+
+	// Build options are created before building, so that plugins are not shared between builds.
+	options := make([]esbuild.BuildOptions, len(names))
+	for i, name := range names {
+		buildOptions, err := compileOptions(config)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		buildOptions.EntryPoints = patterns[name]
+		buildOptions.Write = false
+		options[i] = buildOptions
+	}
+
+	concurrency := config.CompileConcurrency
+	if concurrency <= 0 {
+		concurrency = runtime.NumCPU()
+	}
+
+	results := make([]esbuild.BuildResult, len(names))
+	groups := make([]compileGroupResult, len(names))
+	semaphore := make(chan struct{}, concurrency)
+	outputs := &shardOutputs{written: map[string]bool{}}
+
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Go(func() {
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			start := time.Now()
+			results[i] = esbuild.Build(options[i])
+
+			if len(results[i].Errors) == 0 {
+				if err := outputs.write(results[i].OutputFiles); err != nil {
+					results[i].Errors = append(results[i].Errors, esbuild.Message{
+						Text:   "Failed to write outputs",
+						Detail: err.Error(),
+					})
+				}
+			}
+
+			groups[i] = compileGroupResult{
+				Name:       name,
+				Precompile: patterns[name],
+				Duration:   time.Since(start).Milliseconds(),
+				Errors:     results[i].Errors,
+				Warnings:   results[i].Warnings,
+			}
+		})
+	}
+	wg.Wait()
+
+	return results, groups, nil
+}
+
+// The outputs written by the groups of a sharded compile.
+type shardOutputs struct {
+	mutex   sync.Mutex
+	written map[string]bool
+}
+
+// Writes the given `outputFiles` of a group, except those already written by another group.
+func (s *shardOutputs) write(outputFiles []esbuild.OutputFile) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, output := range outputFiles {
+		if s.written[output.Path] {
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(output.Path), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(output.Path, output.Contents, 0644); err != nil {
+			return err
+		}
+
+		s.written[output.Path] = true
+	}
+
+	return nil
+}
+
+// Partitions the `Precompile` globs of the given `config` into groups, and returns the group names
+// in the order they were first seen, and the globs of each group. Globs within a Ruby gem are
+// grouped by gem, and all others by the directory before their first wildcard.
+func precompileGroups(config *types.ConfigT) ([]string, map[string][]string) {
+	var names []string
+	patterns := map[string][]string{}
+
+	for _, pattern := range config.Precompile {
+		name := precompileGroupName(config, pattern)
+
+		if _, ok := patterns[name]; !ok {
+			names = append(names, name)
+		}
+		patterns[name] = append(patterns[name], pattern)
+	}
+
+	return names, patterns
+}
+
+func precompileGroupName(config *types.ConfigT, pattern string) string {
+	if gemName, _, found := utils.PathIsRubyGem(config, pattern); found {
+		return types.RubyGemsScope + gemName
+	}
+
+	trimmed := strings.TrimPrefix(strings.TrimPrefix(pattern, "./"), "node_modules/")
+	if utils.IsRubyGem(trimmed) {
+		gemName, _, _ := strings.Cut(strings.TrimPrefix(trimmed, types.RubyGemsScope), "/")
+		return types.RubyGemsScope + gemName
+	}
+
+	segments := strings.Split(strings.TrimPrefix(pattern, "./"), "/")
+
+	var dir []string
+	for _, segment := range segments[:len(segments)-1] {
+		if strings.ContainsAny(segment, "*?[{") {
+			break
+		}
+		dir = append(dir, segment)
+	}
+
+	if len(dir) == 0 {
+		return "."
+	}
+
+	return strings.Join(dir, "/")
+}
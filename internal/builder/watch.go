@@ -0,0 +1,182 @@
+package builder
+
+import (
+	"bytes"
+	"encoding/json"
+	"joelmoss/proscenium/internal/replacements"
+	"joelmoss/proscenium/internal/types"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	esbuild "github.com/joelmoss/esbuild-internal/api"
+)
+
+// Emitted by `Watch` after each build.
+type WatchEvent struct {
+	Errors   []esbuild.Message
+	Warnings []esbuild.Message
+
+	// Paths of the output files that were written by the build, relative to the root. Source maps are
+	// written alongside their output files, but are not listed.
+	Changed []string
+
+	// Paths of the output files that were removed, as they are no longer built, relative to the root.
+	// Source maps are not listed.
+	Removed []string
+}
+
+// Compiles all entry points matching the `Precompile` globs of the given `config`, and then watches
+// all of their inputs for changes, rebuilding when they do. Unlike `Compile`, the output directory
+// is not deleted, and only outputs that have changed are written. The `onEvent` function is called
+// after each build with the outputs that changed.
+//
+// Returns a function that stops watching, or false and the JSON encoded errors if watching could
+// not be started. Sharded and legacy compiles are not supported, so are rejected.
+func Watch(config *types.ConfigT, onEvent func(WatchEvent)) (stop func(), success bool, messages string) {
+	if len(config.Precompile) == 0 {
+		success, messages = compileError(
+			"No precompile paths specified",
+			"The `precompile` configuration option must be an array, and specify at least one path or glob path to compile.",
+		)
+		return nil, success, messages
+	}
+
+	if config.ShardCompile || len(config.LegacyTargets) > 0 {
+		success, messages = compileError(
+			"Unsupported watch options",
+			"The `shard_compile` and `legacy_targets` configuration options are only supported by compile.",
+		)
+		return nil, success, messages
+	}
+
+	if _, err := replacements.Build(); err != nil {
+		success, messages = compileError("build npm replacements", err.Error())
+		return nil, success, messages
+	}
+
+	buildOptions, err := compileOptions(config)
+	if err != nil {
+		success, messages = compileError("Invalid build options", err.Error())
+		return nil, success, messages
+	}
+
+	// Outputs are written by the watch plugin, so that only those that have changed are written.
+	buildOptions.Write = false
+	buildOptions.Plugins = append(buildOptions.Plugins, watchPlugin(config, onEvent))
+
+	ctx, ctxErr := esbuild.Context(buildOptions)
+	if ctxErr != nil {
+		success, messages = compileError("Failed to create build context", ctxErr.Error())
+		return nil, success, messages
+	}
+
+	// The initial build writes all outputs.
+	result := ctx.Rebuild()
+	if len(result.Errors) != 0 {
+		ctx.Dispose()
+
+		j, err := json.Marshal(compileResult{Errors: result.Errors, Warnings: result.Warnings})
+		if err != nil {
+			return nil, false, err.Error()
+		}
+		return nil, false, string(j)
+	}
+
+	if err := ctx.Watch(esbuild.WatchOptions{}); err != nil {
+		ctx.Dispose()
+		success, messages = compileError("Failed to watch for changes", err.Error())
+		return nil, success, messages
+	}
+
+	return ctx.Dispose, true, ""
+}
+
+// Writes the output files of each build that have changed since the previous build, removes those
+// that are no longer built, and emits a `WatchEvent`.
+func watchPlugin(config *types.ConfigT, onEvent func(WatchEvent)) esbuild.Plugin {
+	return esbuild.Plugin{
+		Name: "watch",
+		Setup: func(build esbuild.PluginBuild) {
+			// Hashes of the outputs of the previous build, keyed by absolute path.
+			outputs := map[string]string{}
+
+			build.OnEnd(func(result *esbuild.BuildResult) (esbuild.OnEndResult, error) {
+				event := WatchEvent{Errors: result.Errors, Warnings: result.Warnings}
+
+				if len(result.Errors) > 0 {
+					// Keep the previous outputs, so the app continues to work until the errors are fixed.
+					onEvent(event)
+					return esbuild.OnEndResult{}, nil
+				}
+
+				current := make(map[string]string, len(result.OutputFiles))
+
+				for _, output := range result.OutputFiles {
+					current[output.Path] = output.Hash
+
+					if hash, ok := outputs[output.Path]; ok && hash == output.Hash {
+						continue
+					}
+
+					if existing, err := os.ReadFile(output.Path); err == nil && bytes.Equal(existing, output.Contents) {
+						// Already written by a previous run.
+						continue
+					}
+
+					if err := os.MkdirAll(filepath.Dir(output.Path), 0755); err != nil {
+						return esbuild.OnEndResult{}, err
+					}
+
+					if err := os.WriteFile(output.Path, output.Contents, 0644); err != nil {
+						return esbuild.OnEndResult{}, err
+					}
+
+					if !isSourceMap(output.Path) {
+						event.Changed = append(event.Changed, relativeToRoot(config, output.Path))
+					}
+				}
+
+				for outputPath := range outputs {
+					if _, ok := current[outputPath]; !ok {
+						os.Remove(outputPath)
+						if !isSourceMap(outputPath) {
+							event.Removed = append(event.Removed, relativeToRoot(config, outputPath))
+						}
+					}
+				}
+
+				outputs = current
+
+				manifest, err := buildManifest(config, *result)
+				if err != nil {
+					return esbuild.OnEndResult{}, err
+				}
+
+				if err := writeManifest(config, manifest); err != nil {
+					return esbuild.OnEndResult{}, err
+				}
+
+				slices.Sort(event.Changed)
+				slices.Sort(event.Removed)
+
+				onEvent(event)
+
+				return esbuild.OnEndResult{}, nil
+			})
+		},
+	}
+}
+
+func isSourceMap(path string) bool {
+	return strings.HasSuffix(path, ".map")
+}
+
+func relativeToRoot(config *types.ConfigT, absPath string) string {
+	if relPath, err := filepath.Rel(config.RootPath, absPath); err == nil {
+		return relPath
+	}
+
+	return absPath
+}
@@ -0,0 +1,401 @@
+// Package cli implements the proscenium command, which drives the builder, resolver and compiler
+// outside of Ruby. See cmd/proscenium for its usage.
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"joelmoss/proscenium/internal/builder"
+	"joelmoss/proscenium/internal/debug"
+	"joelmoss/proscenium/internal/resolver"
+	"joelmoss/proscenium/internal/types"
+	"os"
+	"strings"
+
+	esbuild "github.com/joelmoss/esbuild-internal/api"
+)
+
+const usage = `Usage: proscenium <command> [flags]
+
+Commands:
+  build <specifier>     Build the given entry point, and print its output.
+  resolve <specifier>   Resolve the given specifier to a URL path and absolute path.
+  compile               Compile all entry points matching the precompile globs.
+  watch                 Compile, and then recompile whenever an input changes.
+
+Run 'proscenium <command> -h' for the flags of each command.
+`
+
+type options struct {
+	configPath string
+	root       string
+	outputDir  string
+	env        string
+	precompile string
+	importer   string
+	debug      bool
+	json       bool
+	shard      bool
+	ssr        bool
+}
+
+// Runs the command given by `args`, without the program name, and returns its exit code. Watching
+// stops once `ctx` is done.
+func Run(ctx context.Context, args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+
+	command := args[0]
+	if command == "-h" || command == "-help" || command == "--help" || command == "help" {
+		fmt.Fprint(stdout, usage)
+		return 0
+	}
+
+	var opts options
+	flags := flag.NewFlagSet(command, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVar(&opts.configPath, "config", "", "Path to a JSON config file, or \"-\" to read from stdin")
+	flags.StringVar(&opts.root, "root", "", "Root path of the app (default: current directory)")
+	flags.StringVar(&opts.outputDir, "output-dir", "", "Output directory, relative to the root (default: public/assets)")
+	flags.StringVar(&opts.env, "env", "", "Environment: development, test or production (default: development)")
+	flags.BoolVar(&opts.debug, "debug", false, "Enable debug output")
+	flags.BoolVar(&opts.json, "json", false, "Print results and errors as JSON")
+
+	switch command {
+	case "build":
+		flags.BoolVar(&opts.ssr, "ssr", false, "Build for server-side rendering by a JS runtime")
+	case "resolve":
+		flags.StringVar(&opts.importer, "importer", "", "Resolve the specifier relative to this path")
+	case "compile":
+		flags.StringVar(&opts.precompile, "precompile", "", "Comma separated list of glob patterns to precompile")
+		flags.BoolVar(&opts.shard, "shard", false, "Build groups of entry points concurrently, grouped by directory or gem")
+	case "watch":
+		flags.StringVar(&opts.precompile, "precompile", "", "Comma separated list of glob patterns to precompile")
+	default:
+		fmt.Fprintf(stderr, "Unknown command %q\n\n%s", command, usage)
+		return 2
+	}
+
+	specifier, err := parseFlags(flags, args[1:])
+	if err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+
+	if command != "compile" && command != "watch" && specifier == "" {
+		fmt.Fprintf(stderr, "The %s command requires a specifier\n", command)
+		return 2
+	}
+
+	config, err := loadConfig(opts, stdin)
+	if err != nil {
+		return printError(stdout, stderr, opts, esbuild.Message{Text: "Invalid config", Detail: err.Error()})
+	}
+
+	switch command {
+	case "build":
+		return runBuild(config, specifier, opts, stdout, stderr)
+	case "resolve":
+		return runResolve(config, specifier, opts, stdout, stderr)
+	case "watch":
+		return runWatch(ctx, config, opts, stdout, stderr)
+	default:
+		return runCompile(config, opts, stdout, stderr)
+	}
+}
+
+// Parses the given `args`, allowing flags to appear both before and after the positional
+// specifier, which is returned.
+func parseFlags(flags *flag.FlagSet, args []string) (string, error) {
+	if err := flags.Parse(args); err != nil {
+		return "", err
+	}
+
+	if flags.NArg() == 0 {
+		return "", nil
+	}
+
+	specifier := flags.Arg(0)
+	if err := flags.Parse(flags.Args()[1:]); err != nil {
+		return "", err
+	}
+
+	return specifier, nil
+}
+
+// Builds the config from the config file or PROSCENIUM_CONFIG environment variable, and then
+// applies the given flags.
+func loadConfig(opts options, stdin io.Reader) (*types.ConfigT, error) {
+	var data []byte
+	var err error
+
+	switch opts.configPath {
+	case "":
+		data = []byte(os.Getenv("PROSCENIUM_CONFIG"))
+	case "-":
+		data, err = io.ReadAll(stdin)
+	default:
+		data, err = os.ReadFile(opts.configPath)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	config := types.NewConfig()
+	if len(strings.TrimSpace(string(data))) > 0 {
+		if config, err = types.ParseConfig(data); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.root != "" {
+		config.RootPath = opts.root
+	}
+	if config.RootPath == "" {
+		if config.RootPath, err = os.Getwd(); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.outputDir != "" {
+		config.OutputDir = opts.outputDir
+	}
+	if config.OutputDir == "" {
+		config.OutputDir = "public/assets"
+	}
+
+	if opts.env != "" {
+		env, ok := parseEnvironment(opts.env)
+		if !ok {
+			return nil, fmt.Errorf("unknown environment %q", opts.env)
+		}
+		config.Environment = env
+	}
+	if config.Environment == 0 {
+		config.Environment = types.DevEnv
+	}
+
+	if opts.precompile != "" {
+		config.Precompile = strings.Split(opts.precompile, ",")
+	}
+
+	if opts.shard {
+		config.ShardCompile = true
+	}
+
+	if opts.ssr {
+		config.Ssr = true
+	}
+
+	if config.Debug || opts.debug {
+		config.Debug = true
+		debug.Enable()
+	}
+
+	return config, nil
+}
+
+func parseEnvironment(name string) (types.Environment, bool) {
+	for _, env := range []types.Environment{types.DevEnv, types.TestEnv, types.ProdEnv} {
+		if env.String() == name {
+			return env, true
+		}
+	}
+
+	return 0, false
+}
+
+func runBuild(config *types.ConfigT, specifier string, opts options, stdout io.Writer, stderr io.Writer) int {
+	success, result, contentHash := builder.BuildToString(config, specifier)
+
+	if !success {
+		// Build errors are returned as a JSON encoded esbuild message.
+		var message esbuild.Message
+		if err := json.Unmarshal([]byte(result), &message); err != nil {
+			message = esbuild.Message{Text: result}
+		}
+
+		return printError(stdout, stderr, opts, message)
+	}
+
+	if opts.json {
+		return printJson(stdout, stderr, map[string]any{
+			"success":     true,
+			"code":        result,
+			"contentHash": contentHash,
+			"integrity":   builder.Integrity(config, []byte(result)),
+		})
+	}
+
+	fmt.Fprintln(stdout, result)
+	return 0
+}
+
+func runResolve(config *types.ConfigT, specifier string, opts options, stdout io.Writer, stderr io.Writer) int {
+	urlPath, absPath, err := resolver.Resolve(config, specifier, opts.importer)
+	if err != nil {
+		return printError(stdout, stderr, opts, esbuild.Message{
+			Text:   fmt.Sprintf("Could not resolve %q", specifier),
+			Detail: err.Error(),
+		})
+	}
+
+	if opts.json {
+		return printJson(stdout, stderr, map[string]any{
+			"success": true,
+			"urlPath": urlPath,
+			"absPath": absPath,
+		})
+	}
+
+	fmt.Fprintln(stdout, urlPath)
+	fmt.Fprintln(stdout, absPath)
+	return 0
+}
+
+func runCompile(config *types.ConfigT, opts options, stdout io.Writer, stderr io.Writer) int {
+	success, result := builder.Compile(config)
+
+	if opts.json {
+		fmt.Fprintln(stdout, result)
+	} else {
+		printCompileMessages(stdout, stderr, result)
+
+		if success {
+			fmt.Fprintln(stdout, "Compiled successfully to "+config.OutputDir)
+		}
+	}
+
+	if !success {
+		return 1
+	}
+	return 0
+}
+
+// Compiles and watches until `ctx` is done, printing the outputs that changed after each build. With
+// `-json`, each build is printed as a single line of JSON.
+func runWatch(ctx context.Context, config *types.ConfigT, opts options, stdout io.Writer, stderr io.Writer) int {
+	stop, success, result := builder.Watch(config, func(event builder.WatchEvent) {
+		if opts.json {
+			line, err := json.Marshal(event)
+			if err != nil {
+				fmt.Fprintln(stderr, "error: "+err.Error())
+				return
+			}
+			fmt.Fprintln(stdout, string(line))
+			return
+		}
+
+		printMessages(stderr, event.Errors, event.Warnings)
+		for _, changed := range event.Changed {
+			fmt.Fprintln(stdout, "changed: "+changed)
+		}
+		for _, removed := range event.Removed {
+			fmt.Fprintln(stdout, "removed: "+removed)
+		}
+	})
+
+	if !success {
+		if opts.json {
+			fmt.Fprintln(stdout, result)
+		} else {
+			printCompileMessages(stdout, stderr, result)
+		}
+		return 1
+	}
+
+	defer stop()
+
+	if !opts.json {
+		fmt.Fprintln(stdout, "Watching for changes. Press Ctrl-C to stop.")
+	}
+
+	<-ctx.Done()
+
+	return 0
+}
+
+// Prints the errors and warnings of the given JSON encoded compile `result`, and the timings of each
+// group of entry points, if sharded.
+func printCompileMessages(stdout io.Writer, stderr io.Writer, result string) {
+	var messages struct {
+		Errors   []esbuild.Message
+		Warnings []esbuild.Message
+		Groups   []struct {
+			Name     string
+			Duration int64
+			Errors   []esbuild.Message
+		}
+	}
+	if err := json.Unmarshal([]byte(result), &messages); err != nil {
+		fmt.Fprintln(stderr, result)
+		return
+	}
+
+	printMessages(stderr, messages.Errors, messages.Warnings)
+
+	for _, group := range messages.Groups {
+		status := "ok"
+		if len(group.Errors) > 0 {
+			status = fmt.Sprintf("%d errors", len(group.Errors))
+		}
+
+		fmt.Fprintf(stdout, "%s: %dms (%s)\n", group.Name, group.Duration, status)
+	}
+}
+
+func printMessages(stderr io.Writer, errors []esbuild.Message, warnings []esbuild.Message) {
+	for _, msg := range warnings {
+		fmt.Fprintln(stderr, "warning: "+formatMessage(msg))
+	}
+	for _, msg := range errors {
+		fmt.Fprintln(stderr, "error: "+formatMessage(msg))
+	}
+}
+
+func printError(stdout io.Writer, stderr io.Writer, opts options, message esbuild.Message) int {
+	if opts.json {
+		printJson(stdout, stderr, map[string]any{
+			"success": false,
+			"error":   message,
+		})
+	} else {
+		fmt.Fprintln(stderr, "error: "+formatMessage(message))
+	}
+
+	return 1
+}
+
+func printJson(stdout io.Writer, stderr io.Writer, value any) int {
+	encoder := json.NewEncoder(stdout)
+	encoder.SetIndent("", "  ")
+
+	if err := encoder.Encode(value); err != nil {
+		fmt.Fprintln(stderr, "error: "+err.Error())
+		return 1
+	}
+
+	return 0
+}
+
+// Formats the given esbuild `message` as a single human readable line.
+func formatMessage(message esbuild.Message) string {
+	text := message.Text
+
+	if detail, ok := message.Detail.(string); ok && detail != "" {
+		text += " - " + detail
+	}
+
+	if loc := message.Location; loc != nil {
+		text += fmt.Sprintf(" at %s:%d:%d", loc.File, loc.Line, loc.Column)
+	}
+
+	return text
+}
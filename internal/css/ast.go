@@ -0,0 +1,369 @@
+package css
+
+import (
+	"github.com/riking/cssparse/tokenizer"
+)
+
+// A node of the syntax tree of a stylesheet.
+type cssNode interface {
+	// The span of the node within the source of its stylesheet.
+	span() cssSpan
+
+	// Writes the CSS of the node to `out`.
+	print(out *cssPrinter)
+}
+
+// The syntax tree of a stylesheet.
+type cssStylesheet struct {
+	filePath string
+
+	// The normalised source of the stylesheet, which the spans of its nodes refer to.
+	source string
+
+	nodes []cssNode
+
+	// Offsets of the start of each line of the source, which are computed when first needed.
+	lineOffsets []int
+}
+
+// An at-rule, such as `@media screen { ... }` or `@import "foo.css";`.
+type cssAtRule struct {
+	cssSpan
+
+	// The at-keyword token, whose value is the name of the at-rule without the "@".
+	name cssToken
+
+	// The tokens between the name and the block or semicolon.
+	prelude []cssToken
+
+	// The block of the at-rule, or nil if it has none.
+	block *cssBlock
+
+	semicolon bool
+}
+
+// A qualified rule, such as `header > a { ... }`.
+type cssRule struct {
+	cssSpan
+
+	// The tokens of the selector, including any whitespace before the block.
+	prelude []cssToken
+
+	block *cssBlock
+}
+
+// A declaration, such as `color: red;`.
+type cssDeclaration struct {
+	cssSpan
+
+	property cssToken
+
+	// The tokens following the property, including the colon, but not the semicolon.
+	tokens []cssToken
+
+	semicolon bool
+}
+
+// Tokens that are not part of a rule or declaration, such as whitespace, comments and stray
+// semicolons. These are passed through as is.
+type cssRaw struct {
+	cssSpan
+	tokens []cssToken
+}
+
+// The contents of a `{ ... }` block.
+type cssBlock struct {
+	cssSpan
+	nodes []cssNode
+
+	// False if the end of the stylesheet was reached before the closing brace.
+	closed bool
+}
+
+// Parses the given CSS `input` into a syntax tree. Parsing never fails; anything that is not
+// understood is kept as raw tokens, so that printing the tree always reproduces the input.
+func parseStylesheet(input string, filePath string) *cssStylesheet {
+	stylesheet := &cssStylesheet{filePath: filePath, source: normalizeInput.Replace(input)}
+
+	tokens := tokenize(stylesheet.source)
+	for i := range tokens {
+		tokens[i].stylesheet = stylesheet
+	}
+
+	b := &cssTreeBuilder{tokens: tokens}
+	stylesheet.nodes = b.parseNodes(false)
+
+	return stylesheet
+}
+
+// Parses the given generated CSS `input`, such as custom properties generated from a tokens file.
+// It has no source of its own, so all its tokens are given the location of `origin`.
+func parseGeneratedCss(input string, origin cssToken) []cssNode {
+	tokens := tokenize(input)
+	for i := range tokens {
+		tokens[i].cssSpan = origin.cssSpan
+		tokens[i].stylesheet = origin.stylesheet
+	}
+
+	b := &cssTreeBuilder{tokens: tokens}
+	return b.parseNodes(false)
+}
+
+// Returns the value of the declaration, which is all tokens following the colon.
+func (d *cssDeclaration) value() []cssToken {
+	for i, token := range d.tokens {
+		if token.Type == tokenizer.TokenColon {
+			return d.tokens[i+1:]
+		}
+	}
+
+	return nil
+}
+
+func (r *cssAtRule) print(out *cssPrinter) {
+	out.writeToken(r.name)
+	printTokens(out, r.prelude)
+
+	if r.block != nil {
+		r.block.print(out)
+	} else if r.semicolon {
+		out.write(";")
+	}
+}
+
+func (r *cssRule) print(out *cssPrinter) {
+	printTokens(out, r.prelude)
+	r.block.print(out)
+}
+
+func (d *cssDeclaration) print(out *cssPrinter) {
+	out.writeToken(d.property)
+	printTokens(out, d.tokens)
+
+	if d.semicolon {
+		out.write(";")
+	}
+}
+
+func (r *cssRaw) print(out *cssPrinter) {
+	printTokens(out, r.tokens)
+}
+
+func (b *cssBlock) print(out *cssPrinter) {
+	out.write("{")
+	printNodes(out, b.nodes)
+
+	if b.closed {
+		out.write("}")
+	}
+}
+
+func printNodes(out *cssPrinter, nodes []cssNode) {
+	for _, node := range nodes {
+		node.print(out)
+	}
+}
+
+func printTokens(out *cssPrinter, tokens []cssToken) {
+	for _, token := range tokens {
+		out.writeToken(token)
+	}
+}
+
+// Builds the syntax tree from a stream of tokens.
+type cssTreeBuilder struct {
+	tokens []cssToken
+
+	// Index of the next token.
+	position int
+}
+
+func (b *cssTreeBuilder) peek() cssToken {
+	return b.tokens[b.position]
+}
+
+// Returns the next token. The stop token at the end of the stream is never consumed, so it is
+// returned for every call once reached.
+func (b *cssTreeBuilder) next() cssToken {
+	token := b.tokens[b.position]
+	if !token.Type.StopToken() {
+		b.position++
+	}
+
+	return token
+}
+
+// Parses a list of rules and declarations. When `nested` is true, this is the contents of a block,
+// and parsing ends at the closing brace, which is not consumed.
+func (b *cssTreeBuilder) parseNodes(nested bool) []cssNode {
+	var nodes []cssNode
+
+	for {
+		token := b.peek()
+
+		switch token.Type {
+		case tokenizer.TokenCloseBrace:
+			if nested {
+				return nodes
+			}
+			nodes = appendRaw(nodes, b.next())
+
+		case tokenizer.TokenS, tokenizer.TokenComment, tokenizer.TokenSemicolon, tokenizer.TokenCDO,
+			tokenizer.TokenCDC:
+			nodes = appendRaw(nodes, b.next())
+
+		case tokenizer.TokenAtKeyword:
+			nodes = append(nodes, b.parseAtRule())
+
+		default:
+			if token.Type.StopToken() {
+				return nodes
+			}
+
+			nodes = append(nodes, b.parseRuleOrDeclaration())
+		}
+	}
+}
+
+func (b *cssTreeBuilder) parseAtRule() *cssAtRule {
+	rule := &cssAtRule{name: b.next()}
+	rule.prelude = b.consumeComponents()
+	rule.cssSpan = spanOf(rule.name, rule.prelude)
+
+	switch b.peek().Type {
+	case tokenizer.TokenOpenBrace:
+		rule.block = b.parseBlock()
+		rule.end = rule.block.end
+	case tokenizer.TokenSemicolon:
+		rule.semicolon = true
+		rule.end = b.next().end
+	}
+
+	return rule
+}
+
+// Parses a qualified rule if a block follows, otherwise a declaration.
+func (b *cssTreeBuilder) parseRuleOrDeclaration() cssNode {
+	start := b.peek().start
+	tokens := b.consumeComponents()
+
+	if b.peek().Type == tokenizer.TokenOpenBrace {
+		rule := &cssRule{prelude: tokens, block: b.parseBlock()}
+		rule.cssSpan = cssSpan{start, rule.block.end}
+		return rule
+	}
+
+	span := spanOf(tokens[0], tokens[1:])
+
+	var semicolon *cssToken
+	if b.peek().Type == tokenizer.TokenSemicolon {
+		token := b.next()
+		semicolon = &token
+		span.end = token.end
+	}
+
+	if !isDeclaration(tokens) {
+		if semicolon != nil {
+			tokens = append(tokens, *semicolon)
+		}
+		return &cssRaw{cssSpan: span, tokens: tokens}
+	}
+
+	return &cssDeclaration{
+		cssSpan:   span,
+		property:  tokens[0],
+		tokens:    tokens[1:],
+		semicolon: semicolon != nil,
+	}
+}
+
+func (b *cssTreeBuilder) parseBlock() *cssBlock {
+	block := &cssBlock{cssSpan: b.next().cssSpan}
+	block.nodes = b.parseNodes(true)
+
+	if len(block.nodes) > 0 {
+		block.end = block.nodes[len(block.nodes)-1].span().end
+	}
+
+	if b.peek().Type == tokenizer.TokenCloseBrace {
+		block.closed = true
+		block.end = b.next().end
+	}
+
+	return block
+}
+
+// Consumes and returns all tokens up to the next open brace, close brace or semicolon that is not
+// within parentheses or brackets.
+func (b *cssTreeBuilder) consumeComponents() []cssToken {
+	var tokens []cssToken
+	depth := 0
+
+	for {
+		token := b.peek()
+
+		switch token.Type {
+		case tokenizer.TokenOpenBrace, tokenizer.TokenSemicolon:
+			if depth == 0 {
+				return tokens
+			}
+		case tokenizer.TokenCloseBrace:
+			// A close brace always ends the components, so that an unbalanced parenthesis cannot
+			// consume the rest of the block.
+			return tokens
+		case tokenizer.TokenOpenParen, tokenizer.TokenOpenBracket, tokenizer.TokenFunction:
+			depth++
+		case tokenizer.TokenCloseParen, tokenizer.TokenCloseBracket:
+			depth = max(depth-1, 0)
+		default:
+			if token.Type.StopToken() {
+				return tokens
+			}
+		}
+
+		tokens = append(tokens, b.next())
+	}
+}
+
+// Whether the given tokens are a declaration; an identifier followed by a colon.
+func isDeclaration(tokens []cssToken) bool {
+	if tokens[0].Type != tokenizer.TokenIdent {
+		return false
+	}
+
+	for _, token := range tokens[1:] {
+		switch token.Type {
+		case tokenizer.TokenS, tokenizer.TokenComment:
+			continue
+		case tokenizer.TokenColon:
+			return true
+		}
+
+		break
+	}
+
+	return false
+}
+
+// Appends the given token to `nodes`, extending the last node if it is also raw.
+func appendRaw(nodes []cssNode, token cssToken) []cssNode {
+	if len(nodes) > 0 {
+		if raw, ok := nodes[len(nodes)-1].(*cssRaw); ok {
+			raw.tokens = append(raw.tokens, token)
+			raw.end = token.end
+			return nodes
+		}
+	}
+
+	return append(nodes, &cssRaw{cssSpan: token.cssSpan, tokens: []cssToken{token}})
+}
+
+// Returns the span from the start of `first` to the end of the last of `rest`.
+func spanOf(first cssToken, rest []cssToken) cssSpan {
+	span := first.cssSpan
+	if len(rest) > 0 {
+		span.end = rest[len(rest)-1].end
+	}
+
+	return span
+}
@@ -3,14 +3,8 @@ package css
 import (
 	"joelmoss/proscenium/internal/types"
 	"os"
-
-	"github.com/riking/cssparse/tokenizer"
 )
 
-const debug = false
-
-type handleNextTokenUntilFunc func(token *tokenizer.Token) bool
-
 // CssWarning represents a non-fatal warning generated during CSS parsing.
 type CssWarning struct {
 	Text     string
@@ -21,34 +15,43 @@ type CssWarning struct {
 	LineText string
 }
 
-// Parse the given CSS file, and return the transformed CSS.
+// Parse the given CSS file, and return the transformed CSS, along with the absolute paths of any
+// mixin files that it depends on. The CSS ends with an inline source map, which maps each rule and
+// declaration back to where it was written, including those included from mixin files.
 //
 // Arguments:
+//   - config: The config to resolve mixin files with.
 //   - path: The absolute file system path of the file being parsed.
-func ParseCssFile(path string) (string, []CssWarning, error) {
+func ParseCssFile(config *types.ConfigT, path string) (string, []CssWarning, []string, error) {
 	input, err := os.ReadFile(path)
 	if err != nil {
-		return "", nil, err
+		return "", nil, nil, err
 	}
 
-	return ParseCss(string(input), path)
+	p := newCssParser(config, string(input), path)
+	p.sourceMap = true
+	output, warnings, err := p.parse()
+
+	return output, warnings, p.dependencies, err
 }
 
 // Parse the given CSS, and return the transformed CSS.
 //
 // Arguments:
+//   - config: The config to resolve mixin files with.
 //   - input: The CSS to parse.
 //   - path: The absolute file system path of the file being parsed.
-func ParseCss(input string, path string) (string, []CssWarning, error) {
-	t, _ := newCssTokenizer(input, path)
+func ParseCss(config *types.ConfigT, input string, path string) (string, []CssWarning, error) {
+	p := newCssParser(config, input, path)
+	return p.parse()
+}
 
-	p := cssParser{
-		tokens:   t,
-		input:    input,
-		filePath: path,
-		rootPath: types.Config.RootPath,
-		mixins:   cssMixins{},
+func newCssParser(config *types.ConfigT, input string, path string) *cssParser {
+	return &cssParser{
+		input:       input,
+		filePath:    path,
+		config:      config,
+		mixins:      cssMixins{},
+		customMedia: cssCustomMedia{},
 	}
-
-	return p.parse()
 }
@@ -0,0 +1,146 @@
+package css
+
+import (
+	"joelmoss/proscenium/internal/resolver"
+	"slices"
+	"strings"
+
+	"github.com/riking/cssparse/tokenizer"
+)
+
+// Map of custom media queries, keyed by the absolute path of the file they are defined in and their
+// name, separated by "#".
+type cssCustomMedia map[string][]cssToken
+
+// Parses the prelude of the given `@custom-media` rule, which either defines a custom media query:
+// `@custom-media --small (max-width: 30em);`, or imports one from another file:
+// `@custom-media --small from url("/lib/breakpoints.css");`.
+func parseCustomMedia(rule *cssAtRule) (name cssToken, query []cssToken, uri string, ok bool) {
+	prelude := trimTokens(rule.prelude)
+	if rule.block != nil || len(prelude) < 2 || prelude[0].Type != tokenizer.TokenIdent ||
+		!strings.HasPrefix(prelude[0].Value, "--") {
+		return name, nil, "", false
+	}
+
+	name = prelude[0]
+	query = trimTokens(prelude[1:])
+
+	if len(query) > 1 && query[0].Type == tokenizer.TokenIdent &&
+		strings.EqualFold(query[0].Value, "from") {
+		if rest := trimTokens(query[1:]); len(rest) == 1 && rest[0].Type == tokenizer.TokenURI {
+			return name, nil, rest[0].Value, true
+		}
+	}
+
+	return name, query, "", len(query) > 0
+}
+
+// Adds each `@custom-media` rule at the root of `stylesheet` to the custom media definitions.
+// Custom media can be used anywhere in the stylesheet, so this is done before it is transformed.
+func (p *cssParser) defineCustomMedia(stylesheet *cssStylesheet) {
+	for _, node := range stylesheet.nodes {
+		rule, ok := node.(*cssAtRule)
+		if !ok || rule.name.Value != "custom-media" {
+			continue
+		}
+
+		name, query, uri, ok := parseCustomMedia(rule)
+		if !ok {
+			continue
+		}
+
+		key := stylesheet.filePath + "#" + name.Value
+
+		if uri == "" {
+			p.customMedia[key] = query
+			continue
+		}
+
+		span := cssSpan{rule.start, name.end}
+
+		_, absPath, err := resolver.Resolve(p.config, uri, stylesheet.filePath)
+		if err != nil {
+			p.addWarning(stylesheet, span, "Could not resolve custom media file %q for %q", uri, name.Value)
+			continue
+		}
+
+		if _, ok := p.customMedia[absPath+"#"+name.Value]; !ok {
+			if !p.parseDefinitions(absPath) {
+				p.addWarning(stylesheet, span, "Could not resolve custom media file %q for %q", uri, name.Value)
+				continue
+			}
+
+			p.addDependency(absPath)
+		}
+
+		if query, ok := p.customMedia[absPath+"#"+name.Value]; ok {
+			p.customMedia[key] = query
+		} else {
+			p.addWarning(stylesheet, span, "Custom media %q not found in %q", name.Value, absPath)
+		}
+	}
+}
+
+// Returns the given prelude of a `@media` rule of `stylesheet`, with each custom media query, such
+// as `(--small)`, replaced by its definition.
+func (p *cssParser) expandCustomMedia(stylesheet *cssStylesheet, prelude []cssToken) []cssToken {
+	return p.expandCustomMediaQuery(stylesheet, prelude, nil)
+}
+
+// Expands the custom media queries of the given `query`. As definitions may also use custom media,
+// `expanding` holds the names of those currently being expanded, so that cycles are detected.
+func (p *cssParser) expandCustomMediaQuery(stylesheet *cssStylesheet, query []cssToken,
+	expanding []string) []cssToken {
+	result := make([]cssToken, 0, len(query))
+
+	for i := 0; i < len(query); i++ {
+		name, end, ok := customMediaReference(query[i:])
+		if !ok {
+			result = append(result, query[i])
+			continue
+		}
+
+		definition, found := p.customMedia[stylesheet.filePath+"#"+name.Value]
+		switch {
+		case !found:
+			p.addWarning(stylesheet, name.cssSpan, "Custom media %q not defined in %q", name.Value,
+				stylesheet.filePath)
+		case slices.Contains(expanding, name.Value):
+			p.addWarning(stylesheet, name.cssSpan, "Custom media %q references itself", name.Value)
+		default:
+			// Definitions are expanded within the stylesheet they are defined in.
+			result = append(result, p.expandCustomMediaQuery(definition[0].stylesheet, definition,
+				append(expanding, name.Value))...)
+			i += end
+			continue
+		}
+
+		result = append(result, query[i])
+	}
+
+	return result
+}
+
+// Returns the name of the custom media reference at the start of `tokens`, such as `(--small)`, and
+// the index of its closing parenthesis.
+func customMediaReference(tokens []cssToken) (cssToken, int, bool) {
+	if tokens[0].Type != tokenizer.TokenOpenParen {
+		return cssToken{}, 0, false
+	}
+
+	for i := 1; i < len(tokens); i++ {
+		if tokens[i].Type != tokenizer.TokenCloseParen {
+			continue
+		}
+
+		inner := trimTokens(tokens[1:i])
+		if len(inner) == 1 && inner[0].Type == tokenizer.TokenIdent &&
+			strings.HasPrefix(inner[0].Value, "--") {
+			return inner[0], i, true
+		}
+
+		break
+	}
+
+	return cssToken{}, 0, false
+}
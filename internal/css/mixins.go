@@ -3,98 +3,283 @@ package css
 import (
 	"joelmoss/proscenium/internal/resolver"
 	"os"
+	"slices"
+	"strings"
 
 	"github.com/riking/cssparse/tokenizer"
 )
 
-type cssMixins map[string]string
+// A mixin definition, and the stylesheet in which it is defined.
+type cssMixin struct {
+	stylesheet *cssStylesheet
+	params     []cssMixinParam
+	nodes      []cssNode
+}
+
+// A parameter of a mixin definition, such as `$color` or `$size: 1rem`.
+type cssMixinParam struct {
+	// The name of the parameter without the "$".
+	name string
+
+	defaultValue []cssToken
+
+	// Whether the parameter has a default value, and so its argument can be omitted.
+	optional bool
+}
 
-// Takes a mixin name and uri, and builds the mixin definition as a map of tokens. These tokens are
-// then inserted into the tokenizer stream, and will be parsed as part of the current stylesheet.
-func (p *cssParser) resolveMixin(mixinIdent string, uri string) bool {
-	if mixinIdent == "" {
+// Map of mixin definitions, keyed by the absolute path of the file they are defined in and their
+// name, separated by "#".
+type cssMixins map[string]cssMixin
+
+// Adds the given `@define-mixin` rule of `stylesheet` to the mixin definitions, and returns whether
+// it was valid. Definitions are not transformed here, but each time they are included.
+//
+// The name of the mixin may be followed by a comma separated list of parameters, each with an
+// optional default value: `@define-mixin button $color, $size: 1rem { ... }`.
+func (p *cssParser) defineMixin(stylesheet *cssStylesheet, rule *cssAtRule) bool {
+	prelude := trimTokens(rule.prelude)
+	if len(prelude) == 0 || prelude[0].Type != tokenizer.TokenIdent || rule.block == nil {
 		return false
 	}
 
-	findAndInsertMixin := func(filePath string, mixinName string) bool {
-		def, ok := p.mixins[filePath+"#"+mixinName]
-		if ok {
-			p.tokens.insertTokens(def, filePath, mixinName)
-			return true
+	mixin := cssMixin{stylesheet: stylesheet, nodes: rule.block.nodes}
+
+	if params := trimTokens(prelude[1:]); len(params) > 0 {
+		for _, tokens := range splitTokens(params) {
+			name, rest, ok := variableName(tokens)
+			if !ok {
+				p.addWarning(stylesheet, spanOf(prelude[0], prelude[1:]),
+					"Invalid parameters for mixin %q", prelude[0].Value)
+				return false
+			}
+
+			param := cssMixinParam{name: name}
+			if rest = trimTokens(rest); len(rest) > 0 && rest[0].Type == tokenizer.TokenColon {
+				param.defaultValue = trimTokens(rest[1:])
+				param.optional = true
+			}
+
+			mixin.params = append(mixin.params, param)
 		}
+	}
 
-		return false
+	p.mixins[stylesheet.filePath+"#"+prelude[0].Value] = mixin
+	return true
+}
+
+// Takes the given `@mixin` rule of `stylesheet`, and returns the transformed nodes of the mixin
+// definition it includes, and whether it was found. The definition is looked up in the file given
+// by the optional url(), or in the current stylesheet.
+//
+// The name of the mixin may be followed by a comma separated list of arguments, which replace the
+// parameters of the mixin: `@mixin button red, 2rem from url("/lib/mixins.css");`.
+func (p *cssParser) includeMixin(stylesheet *cssStylesheet, rule *cssAtRule) ([]cssNode, bool) {
+	prelude := trimTokens(rule.prelude)
+	if len(prelude) == 0 || prelude[0].Type != tokenizer.TokenIdent {
+		return nil, false
 	}
 
-	search := "@mixin " + mixinIdent
+	ident := prelude[0]
+	args := trimTokens(prelude[1:])
+
+	var uri string
+	for i, token := range args {
+		if token.Type == tokenizer.TokenURI {
+			uri = token.Value
+			args = trimTokens(args[:i])
 
+			// Drop the "from" keyword preceding the url.
+			if len(args) > 0 && args[len(args)-1].Type == tokenizer.TokenIdent &&
+				strings.EqualFold(args[len(args)-1].Value, "from") {
+				args = trimTokens(args[:len(args)-1])
+			}
+			break
+		}
+	}
+
+	// Warnings point to the name of the mixin, eg. `@mixin foo`.
+	span := cssSpan{rule.start, ident.end}
+
+	filePath := stylesheet.filePath
 	if uri != "" {
-		// Resolve the uri.
-		_, absPath, err := resolver.Resolve(uri, p.tokens.tokenizers[p.tokens.position].filePath)
+		_, absPath, err := resolver.Resolve(p.config, uri, stylesheet.filePath)
 		if err != nil {
-			p.addWarning(search, "Could not resolve mixin file %q for mixin %q", uri, mixinIdent)
-			return false
+			p.addWarning(stylesheet, span, "Could not resolve mixin file %q for mixin %q", uri, ident.Value)
+			return nil, false
 		}
 
-		if findAndInsertMixin(absPath, mixinIdent) {
-			return true
+		if _, ok := p.mixins[absPath+"#"+ident.Value]; !ok {
+			if !p.parseDefinitions(absPath) {
+				p.addWarning(stylesheet, span, "Could not resolve mixin file %q for mixin %q", uri, ident.Value)
+				return nil, false
+			}
+
+			p.addDependency(absPath)
 		}
 
-		if p.parseMixinDefinitions(absPath) {
-			// We've successfully parsed the mixin file, so look up the definition.
-			if findAndInsertMixin(absPath, mixinIdent) {
-				return true
-			}
-			p.addWarning(search, "Mixin %q not found in %q", mixinIdent, absPath)
-			return false
+		filePath = absPath
+	}
+
+	key := filePath + "#" + ident.Value
+	mixin, ok := p.mixins[key]
+	if !ok {
+		if uri != "" {
+			p.addWarning(stylesheet, span, "Mixin %q not found in %q", ident.Value, filePath)
+		} else {
+			p.addWarning(stylesheet, span, "Mixin %q not defined in %q", ident.Value, filePath)
 		}
+		return nil, false
+	}
 
-		p.addWarning(search, "Could not resolve mixin file %q for mixin %q", uri, mixinIdent)
-		return false
-	} else {
-		filePath := p.tokens.tokenizers[p.tokens.position].filePath
-		if findAndInsertMixin(filePath, mixinIdent) {
-			return true
+	if slices.Contains(p.including, key) {
+		p.addWarning(stylesheet, span, "Mixin %q includes itself", ident.Value)
+		return nil, false
+	}
+
+	var values map[string][]cssToken
+	if len(args) > 0 || len(mixin.params) > 0 {
+		if values, ok = p.bindArguments(stylesheet, span, ident.Value, mixin.params, args); !ok {
+			return nil, false
 		}
-		p.addWarning(search, "Mixin %q not defined in %q", mixinIdent, filePath)
-		return false
 	}
+
+	p.including = append(p.including, key)
+	nodes := p.transform(mixin.stylesheet, substituteNodes(mixin.nodes, values), false)
+	p.including = p.including[:len(p.including)-1]
+
+	return nodes, true
 }
 
-// Parse the given `filePath` for mixin definitions, and append each to the given `mixins` map. This
-// will ignore everything except mixin definitions, and does not parse the mixin definition
-// contents. The parsing is done when the mixin is included.
-func (p *cssParser) parseMixinDefinitions(filePath string) bool {
-	contents, err := os.ReadFile(filePath)
-	if err != nil {
-		return false
+// Returns the values of the given mixin `params`, keyed by their names. Each value is the matching
+// argument of `args`, or the default value of the parameter if the argument is omitted. Adds a
+// warning and returns false if an argument is missing, or there are too many.
+func (p *cssParser) bindArguments(stylesheet *cssStylesheet, span cssSpan, mixinName string,
+	params []cssMixinParam, args []cssToken) (map[string][]cssToken, bool) {
+	var values [][]cssToken
+	if len(args) > 0 {
+		values = splitTokens(args)
 	}
 
-	tokens, err2 := newCssTokenizer(contents, filePath)
-	if err2 != nil {
-		return false
+	if len(values) > len(params) {
+		p.addWarning(stylesheet, span, "Mixin %q accepts %d arguments, but was given %d", mixinName,
+			len(params), len(values))
+		return nil, false
 	}
 
-	tokens.next()
+	result := make(map[string][]cssToken, len(params))
+	for i, param := range params {
+		switch {
+		case i < len(values) && len(values[i]) > 0:
+			result[param.name] = values[i]
+		case param.optional:
+			result[param.name] = param.defaultValue
+		default:
+			p.addWarning(stylesheet, span, "Missing argument $%s for mixin %q", param.name, mixinName)
+			return nil, false
+		}
+	}
+
+	return result, true
+}
 
-	// Iterate through all the tokens in the file, and find any @define-mixin declarations at the root
-	// nesting. Definition blocks are not parsed here.
-	tokens.forEachToken(func(token *tokenizer.Token) bool {
-		if token.Type.StopToken() {
-			return false
+// Returns a copy of the given `nodes`, with each `$name` variable replaced by the matching value
+// of `values`. Variables within strings are not replaced.
+func substituteNodes(nodes []cssNode, values map[string][]cssToken) []cssNode {
+	if len(values) == 0 {
+		return nodes
+	}
+
+	result := make([]cssNode, len(nodes))
+	for i, node := range nodes {
+		switch n := node.(type) {
+		case *cssAtRule:
+			rule := *n
+			rule.prelude = substituteTokens(n.prelude, values)
+			rule.block = substituteBlock(n.block, values)
+			node = &rule
+		case *cssRule:
+			rule := *n
+			rule.prelude = substituteTokens(n.prelude, values)
+			rule.block = substituteBlock(n.block, values)
+			node = &rule
+		case *cssDeclaration:
+			decl := *n
+			decl.tokens = substituteTokens(n.tokens, values)
+			node = &decl
+		case *cssRaw:
+			raw := *n
+			raw.tokens = substituteTokens(n.tokens, values)
+			node = &raw
 		}
 
-		if token.Type == tokenizer.TokenAtKeyword && token.Value == "define-mixin" {
-			key, def := tokens.parseMixinDefinition()
-			if key == "" {
-				return true
-			}
+		result[i] = node
+	}
 
-			p.mixins[filePath+"#"+key] = def
+	return result
+}
+
+func substituteBlock(block *cssBlock, values map[string][]cssToken) *cssBlock {
+	if block == nil {
+		return nil
+	}
+
+	b := *block
+	b.nodes = substituteNodes(block.nodes, values)
+	return &b
+}
+
+func substituteTokens(tokens []cssToken, values map[string][]cssToken) []cssToken {
+	result := make([]cssToken, 0, len(tokens))
+
+	for i := 0; i < len(tokens); i++ {
+		if name, _, ok := variableName(tokens[i:]); ok {
+			if value, ok := values[name]; ok {
+				result = append(result, value...)
+				i++
+				continue
+			}
 		}
 
-		return true
-	})
+		result = append(result, tokens[i])
+	}
+
+	return result
+}
+
+// Returns the name of the `$name` variable at the start of the given `tokens`, and the tokens that
+// follow it.
+func variableName(tokens []cssToken) (string, []cssToken, bool) {
+	if len(tokens) < 2 || tokens[0].Type != tokenizer.TokenDelim || tokens[0].Value != "$" ||
+		tokens[1].Type != tokenizer.TokenIdent || tokens[0].end != tokens[1].start {
+		return "", nil, false
+	}
+
+	return tokens[1].Value, tokens[2:], true
+}
+
+// Parse the given `filePath` for mixin and custom media definitions, and add each to the
+// definitions. This will ignore everything except definitions at the root of the file.
+func (p *cssParser) parseDefinitions(filePath string) bool {
+	contents, err := os.ReadFile(filePath)
+	if err != nil {
+		return false
+	}
+
+	stylesheet := parseStylesheet(string(contents), filePath)
+	p.defineCustomMedia(stylesheet)
+
+	for _, node := range stylesheet.nodes {
+		if rule, ok := node.(*cssAtRule); ok && rule.name.Value == "define-mixin" {
+			p.defineMixin(stylesheet, rule)
+		}
+	}
 
 	return true
 }
+
+// Records the given mixin file as a dependency of the stylesheet being parsed.
+func (p *cssParser) addDependency(filePath string) {
+	if !slices.Contains(p.dependencies, filePath) {
+		p.dependencies = append(p.dependencies, filePath)
+	}
+}
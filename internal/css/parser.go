@@ -2,231 +2,135 @@ package css
 
 import (
 	"fmt"
+	"joelmoss/proscenium/internal/types"
+	"path/filepath"
 	"strings"
-
-	"github.com/riking/cssparse/tokenizer"
 )
 
 type cssParser struct {
-	tokens *cssTokenizer
-
 	input    string
-	output   strings.Builder
 	filePath string
-	rootPath string
+	config   *types.ConfigT
 
-	// Map of mixin names and their contents.
+	// Map of mixin names and their definitions.
 	mixins cssMixins
 
+	// Map of custom media names and their queries.
+	customMedia cssCustomMedia
+
 	// Warnings accumulated during parsing.
 	warnings []CssWarning
 
-	// The nesting level of each `:global` declaration, where each element is a pair of integers. The
-	// first is the nesting level, and the second is 0 (ident) or 1 (function).
-	globalRuleLevels [][2]int
-
-	// The nesting level of each `:local` declaration, where each element is a pair of integers. The
-	// first is the nesting level, and the second is 0 (ident) or 1 (function).
-	localRuleLevels [][2]int
-}
-
-func (p *cssParser) parse() (string, []CssWarning, error) {
-	for {
-		result, ok := p.handleNextToken()
-		if !ok {
-			break
-		}
+	// Absolute paths of the mixin files that were included while parsing.
+	dependencies []string
 
-		p.append(result)
-	}
+	// Keys of the mixins currently being included, used to detect mixins that include themselves.
+	including []string
 
-	return p.output.String(), p.warnings, nil
+	// Whether to append an inline source map to the output.
+	sourceMap bool
 }
 
-// addWarning adds a warning associated with the current file. The search string is used to locate
-// the warning position within the input by searching for it starting from the current output length.
-func (p *cssParser) addWarning(search string, format string, args ...any) {
-	w := CssWarning{
-		Text:     fmt.Sprintf(format, args...),
-		FilePath: p.filePath,
-	}
-
-	if search != "" {
-		// Use output length as approximate position in input. Clamp to valid range since mixin
-		// expansion can make output longer than input.
-		startFrom := p.output.Len() - len(search)
-		if startFrom < 0 {
-			startFrom = 0
-		} else if startFrom > len(p.input) {
-			startFrom = 0
-		}
-
-		idx := strings.Index(p.input[startFrom:], search)
-		if idx >= 0 {
-			idx += startFrom
-		} else if idx = strings.Index(p.input, search); idx < 0 {
-			// Not found at all; skip location info.
-			p.warnings = append(p.warnings, w)
-			return
-		}
-
-		prefix := p.input[:idx]
-		w.Line = strings.Count(prefix, "\n") + 1
-		w.Length = len(search)
+func (p *cssParser) parse() (string, []CssWarning, error) {
+	stylesheet := parseStylesheet(p.input, p.filePath)
+	p.defineCustomMedia(stylesheet)
 
-		lastNL := strings.LastIndex(prefix, "\n")
-		if lastNL == -1 {
-			w.Column = idx
-		} else {
-			w.Column = idx - lastNL - 1
-		}
+	var printer cssPrinter
+	printNodes(&printer, p.transform(stylesheet, stylesheet.nodes, true))
 
-		lineStart := lastNL + 1
-		lineEnd := strings.Index(p.input[lineStart:], "\n")
-		if lineEnd == -1 {
-			w.LineText = p.input[lineStart:]
-		} else {
-			w.LineText = p.input[lineStart : lineStart+lineEnd]
+	if p.sourceMap {
+		if err := printer.writeSourceMapComment(filepath.Dir(p.filePath)); err != nil {
+			return "", nil, err
 		}
 	}
 
-	p.warnings = append(p.warnings, w)
+	return printer.String(), p.warnings, nil
 }
 
-// Append the given input to the output.
-func (p *cssParser) append(input string) {
-	p.tokens.logOutput(input)
-	p.output.WriteString(input)
-}
-
-// Returns the next token, or nil if the end or an error is reached.
-func (p *cssParser) nextToken() *tokenizer.Token {
-	token := p.tokens.next()
-
-	if token.Type.StopToken() {
-		return nil
-	}
-
-	switch token.Type {
-	case tokenizer.TokenCloseBrace:
-		gcount := len(p.globalRuleLevels)
-		if gcount > 0 {
-			glevel := p.globalRuleLevels[gcount-1]
-			if p.tokens.nesting == glevel[0] {
-				p.tokens.log(":global is closed at %v", p.tokens.nesting)
-
-				if glevel[1] > 0 {
-					p.append(token.Value)
+// Transforms the given `nodes` of `stylesheet`, and returns the result. The given nodes are left
+// untouched, as mixin definitions are transformed each time they are included. `root` is true when
+// the nodes are at the root of the stylesheet.
+func (p *cssParser) transform(stylesheet *cssStylesheet, nodes []cssNode, root bool) []cssNode {
+	result := make([]cssNode, 0, len(nodes))
+
+	for _, node := range nodes {
+		switch n := node.(type) {
+		case *cssAtRule:
+			switch n.name.Value {
+			case "define-mixin":
+				// Mixins must be defined at the root, otherwise they are passed through as is.
+				if root && p.defineMixin(stylesheet, n) {
+					continue
 				}
 
-				p.globalRuleLevels = p.globalRuleLevels[:gcount-1]
-
-				return p.nextToken()
-			}
-		}
+			case "mixin":
+				if included, ok := p.includeMixin(stylesheet, n); ok {
+					result = append(result, included...)
+					continue
+				}
 
-		lcount := len(p.localRuleLevels)
-		if lcount > 0 {
-			llevel := p.localRuleLevels[lcount-1]
-			if p.tokens.nesting == llevel[0] {
-				p.tokens.log(":local is closed at %v", p.tokens.nesting)
+			case "custom-media":
+				// Custom media are defined before the stylesheet is transformed.
+				if _, _, _, ok := parseCustomMedia(n); ok && root {
+					continue
+				}
 
-				if llevel[1] > 0 {
-					p.append(token.Value)
+			case "tokens":
+				if included, ok := p.includeTokens(stylesheet, n, root); ok {
+					result = append(result, included...)
+					continue
 				}
 
-				p.localRuleLevels = p.localRuleLevels[:lcount-1]
-				return p.nextToken()
+			case "media":
+				rule := *n
+				rule.prelude = p.expandCustomMedia(stylesheet, n.prelude)
+				n = &rule
+				node = n
 			}
-		}
-	}
 
-	return token
-}
-
-// Iterate over all tokens, passing the given iterator function `iterFn` for each iteration.
-// Returning false from that function will break from the iteration.
-func (p *cssParser) forEachToken(iterFn func(token *tokenizer.Token, nesting int) bool) {
-	for {
-		token := p.nextToken()
+			if n.block != nil {
+				rule := *n
+				rule.block = p.transformBlock(stylesheet, n.block)
+				node = &rule
+			}
 
-		iterResult := iterFn(token, p.tokens.nesting)
-		if !iterResult {
-			break
+		case *cssRule:
+			rule := *n
+			rule.block = p.transformBlock(stylesheet, n.block)
+			node = &rule
 		}
-	}
-}
-
-// Handle the next token and return the output, and whether we should continue. Accepts a
-// `handleNextTokenUntilFunc` as an optional first argument, which is used to determine whether we
-// should stop handling tokens. The function receives the current token, and should return true if
-// it should stop handling tokens.
-func (p *cssParser) handleNextToken(args ...any) (string, bool) {
-	token := p.nextToken()
-	if token == nil {
-		return "", false
-	}
 
-	switch len(args) {
-	case 1:
-		untilFn := args[0].(handleNextTokenUntilFunc)
-		if untilFn(token) {
-			return token.Render(), false
-		}
+		result = append(result, node)
 	}
 
-	switch token.Type {
-	case tokenizer.TokenAtKeyword:
-		switch token.Value {
-		case "define-mixin":
-			key, def := p.tokens.parseMixinDefinition()
-			if key == "" {
-				return token.Render(), true
-			}
-
-			p.mixins[p.filePath+"#"+key] = def
-
-			return "", true
-		case "mixin":
-			var mixinIdent, uri string
-
-			// Capture the mixin declaration, so we can output it later if we fail to resolve it.
-			var original strings.Builder
-			original.WriteString(token.Render())
-
-			// Iterate over all tokens until the next semicolon, to find the mixin name and URI.
-			p.forEachToken(func(token *tokenizer.Token, nesting int) bool {
-				original.WriteString(token.Render())
-
-				if token.Type == tokenizer.TokenSemicolon {
-					// Current token is a semicolon, so we're done. But we need to skip to the next token,
-					// otherwise we get duplicates of the semicolon.
-					p.nextToken()
-
-					return false
-				}
-
-				switch token.Type {
-				case tokenizer.TokenIdent: // get the mixin name.
-					if mixinIdent == "" {
-						mixinIdent = token.Value
-					}
-
-				case tokenizer.TokenURI: // get the mixin URI - if any.
-					uri = token.Value
-				}
+	return result
+}
 
-				return true
-			})
+func (p *cssParser) transformBlock(stylesheet *cssStylesheet, block *cssBlock) *cssBlock {
+	b := *block
+	b.nodes = p.transform(stylesheet, block.nodes, false)
+	return &b
+}
 
-			if p.resolveMixin(mixinIdent, uri) {
-				return "", true
-			} else {
-				t := p.tokens.currentToken()
-				return original.String() + t.Render(), true
-			}
-		}
+// Adds a warning at the given `span` of `stylesheet`.
+func (p *cssParser) addWarning(stylesheet *cssStylesheet, span cssSpan, format string, args ...any) {
+	input := stylesheet.source
+	prefix := input[:span.start]
+	lineStart := strings.LastIndex(prefix, "\n") + 1
+
+	lineEnd := strings.IndexByte(input[lineStart:], '\n')
+	if lineEnd == -1 {
+		lineEnd = len(input)
+	} else {
+		lineEnd += lineStart
 	}
 
-	return token.Render(), true
+	p.warnings = append(p.warnings, CssWarning{
+		Text:     fmt.Sprintf(format, args...),
+		FilePath: stylesheet.filePath,
+		Line:     strings.Count(prefix, "\n") + 1,
+		Column:   span.start - lineStart,
+		Length:   span.end - span.start,
+		LineText: input[lineStart:lineEnd],
+	})
 }
@@ -0,0 +1,178 @@
+package css
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/riking/cssparse/tokenizer"
+)
+
+// Prints the CSS of a syntax tree, and records a source map of where each printed token came from.
+// As mixins are expanded, a token may come from a different file to the stylesheet being printed.
+type cssPrinter struct {
+	out strings.Builder
+
+	// Generated position of the end of the output, where the column is in UTF-16 code units, as
+	// required by source maps.
+	line   int
+	column int
+
+	sources  []*cssStylesheet
+	mappings strings.Builder
+
+	// The previous mapping, as each mapping is encoded relative to it.
+	lastLine         int
+	lastColumn       int
+	lastSource       int
+	lastSourceLine   int
+	lastSourceColumn int
+	hasMappings      bool
+}
+
+func (p *cssPrinter) write(s string) {
+	p.out.WriteString(s)
+
+	if i := strings.LastIndexByte(s, '\n'); i >= 0 {
+		p.line += strings.Count(s, "\n")
+		p.column = utf16Len(s[i+1:])
+	} else {
+		p.column += utf16Len(s)
+	}
+}
+
+// Writes the given `token`, mapping it to its position in its stylesheet.
+func (p *cssPrinter) writeToken(token cssToken) {
+	if token.stylesheet != nil && token.Type != tokenizer.TokenS {
+		p.addMapping(token.stylesheet, token.start)
+	}
+
+	p.write(token.render())
+}
+
+func (p *cssPrinter) addMapping(stylesheet *cssStylesheet, offset int) {
+	source := slices.Index(p.sources, stylesheet)
+	if source == -1 {
+		source = len(p.sources)
+		p.sources = append(p.sources, stylesheet)
+	}
+
+	sourceLine, sourceColumn := stylesheet.position(offset)
+
+	if p.line > p.lastLine {
+		p.mappings.WriteString(strings.Repeat(";", p.line-p.lastLine))
+		p.lastLine = p.line
+		p.lastColumn = 0
+	} else if p.hasMappings {
+		p.mappings.WriteByte(',')
+	}
+
+	writeVLQ(&p.mappings, p.column-p.lastColumn)
+	writeVLQ(&p.mappings, source-p.lastSource)
+	writeVLQ(&p.mappings, sourceLine-p.lastSourceLine)
+	writeVLQ(&p.mappings, sourceColumn-p.lastSourceColumn)
+
+	p.lastColumn = p.column
+	p.lastSource = source
+	p.lastSourceLine = sourceLine
+	p.lastSourceColumn = sourceColumn
+	p.hasMappings = true
+}
+
+// Returns the source map of the printed output as JSON. Sources are relative to `dir`, which should
+// be the directory of the stylesheet being printed.
+func (p *cssPrinter) sourceMap(dir string) ([]byte, error) {
+	sources := make([]string, len(p.sources))
+	contents := make([]string, len(p.sources))
+
+	for i, source := range p.sources {
+		sources[i] = source.filePath
+		if rel, err := filepath.Rel(dir, source.filePath); err == nil {
+			sources[i] = filepath.ToSlash(rel)
+		}
+
+		contents[i] = source.source
+	}
+
+	return json.Marshal(struct {
+		Version        int      `json:"version"`
+		Sources        []string `json:"sources"`
+		SourcesContent []string `json:"sourcesContent"`
+		Mappings       string   `json:"mappings"`
+		Names          []string `json:"names"`
+	}{3, sources, contents, p.mappings.String(), []string{}})
+}
+
+// Appends the source map of the printed output to the output as an inline `sourceMappingURL`
+// comment, which esbuild uses as the input source map of the stylesheet.
+func (p *cssPrinter) writeSourceMapComment(dir string) error {
+	data, err := p.sourceMap(dir)
+	if err != nil {
+		return err
+	}
+
+	p.write("\n/*# sourceMappingURL=data:application/json;base64,")
+	p.write(base64.StdEncoding.EncodeToString(data))
+	p.write(" */\n")
+
+	return nil
+}
+
+func (p *cssPrinter) String() string {
+	return p.out.String()
+}
+
+// Returns the zero-based line and UTF-16 column of the given byte `offset` within the source.
+func (s *cssStylesheet) position(offset int) (int, int) {
+	if s.lineOffsets == nil {
+		s.lineOffsets = []int{0}
+		for i := 0; i < len(s.source); i++ {
+			if s.source[i] == '\n' {
+				s.lineOffsets = append(s.lineOffsets, i+1)
+			}
+		}
+	}
+
+	line, found := slices.BinarySearch(s.lineOffsets, offset)
+	if !found {
+		line--
+	}
+
+	return line, utf16Len(s.source[s.lineOffsets[line]:offset])
+}
+
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += utf16.RuneLen(r)
+	}
+
+	return n
+}
+
+const vlqBase64 = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+
+// Writes the given `value` as a Base64 VLQ, as used by the mappings of source maps.
+func writeVLQ(out *strings.Builder, value int) {
+	vlq := value << 1
+	if value < 0 {
+		vlq = (-value << 1) | 1
+	}
+
+	for {
+		digit := vlq & 31
+		vlq >>= 5
+		if vlq > 0 {
+			digit |= 32
+		}
+
+		out.WriteByte(vlqBase64[digit])
+
+		if vlq == 0 {
+			return
+		}
+	}
+}
@@ -1,205 +1,233 @@
 package css
 
 import (
-	"errors"
-	"fmt"
-	"joelmoss/proscenium/internal/utils"
-	"log"
 	"strings"
 
 	"github.com/riking/cssparse/tokenizer"
 )
 
-type cssTokenizers struct {
-	tokenizer *tokenizer.Tokenizer
-
-	// The file path of the current file being parsed.
-	filePath string
+// The span of a token or node, as byte offsets within the source of its stylesheet.
+type cssSpan struct {
+	start int
+	end   int
 }
 
-type cssTokenizer struct {
-	tokenizers []*cssTokenizers
-
-	// Position of the current tokenizer in the tokenizers slice.
-	position int
-
-	// Nesting level of the current block.
-	nesting int
-
-	incrNestingOnNext bool
+func (s cssSpan) span() cssSpan {
+	return s
 }
 
-func newCssTokenizer(input interface{}, filePath string) (*cssTokenizer, error) {
-	inputString, ok := utils.ToString(input)
-	if !ok {
-		return nil, errors.New("newCssTokenizer: input is not a string")
-	}
-
-	tk := cssTokenizers{
-		tokenizer: tokenizer.NewTokenizer(strings.NewReader(inputString)),
-		filePath:  filePath,
-	}
+// A token of a stylesheet, along with its span within the source.
+type cssToken struct {
+	tokenizer.Token
+	cssSpan
 
-	return &cssTokenizer{
-		tokenizers: []*cssTokenizers{&tk},
-	}, nil
+	// The stylesheet the token was parsed from.
+	stylesheet *cssStylesheet
 }
 
-func (x *cssTokenizer) next() *tokenizer.Token {
-	token := x.currentTokenizer().Next()
+// Normalises the line endings and null bytes of CSS input in the same way as the tokenizer, so that
+// the spans of its tokens can be mapped back onto it.
+var normalizeInput = strings.NewReplacer("\r\n", "\n", "\r", "\n", "\x00", "\uFFFD")
 
-	if token.Type.StopToken() && x.position > 0 {
-		x.position--
-		return x.next()
-	}
-
-	if x.incrNestingOnNext {
-		x.incrNestingOnNext = false
-		x.nesting++
-	}
+// Splits the given `input` into tokens. Tokenizing ends at the first stop token (usually EOF),
+// which is always the last token returned.
+func tokenize(input string) []cssToken {
+	z := tokenizer.NewTokenizer(strings.NewReader(input))
 
-	switch token.Type {
-	case tokenizer.TokenOpenBrace:
-		x.incrNestingOnNext = true
+	var tokens []cssToken
+	offset := 0
 
-	case tokenizer.TokenCloseBrace:
-		x.nesting--
-	}
+	for {
+		token := z.Next()
 
-	x.logToken()
+		if token.Type.StopToken() {
+			return append(tokens, cssToken{Token: token, cssSpan: cssSpan{offset, offset}})
+		}
 
-	return &token
-}
+		end := tokenEnd(input, offset, &token)
+
+		// The tokenizer predates custom properties, so reads `--name` as a "-" delim followed by a
+		// "-name" ident. These are joined into a single `--name` ident.
+		if n := len(tokens); n > 0 && token.Type == tokenizer.TokenIdent &&
+			strings.HasPrefix(token.Value, "-") && tokens[n-1].Type == tokenizer.TokenDelim &&
+			tokens[n-1].Value == "-" && tokens[n-1].end == offset {
+			token.Value = "-" + token.Value
+			tokens[n-1] = cssToken{Token: token, cssSpan: cssSpan{tokens[n-1].start, end}}
+		} else {
+			tokens = append(tokens, cssToken{Token: token, cssSpan: cssSpan{offset, end}})
+		}
 
-func (x *cssTokenizer) currentTokenizer() *tokenizer.Tokenizer {
-	return x.tokenizers[x.position].tokenizer
+		offset = end
+	}
 }
 
-func (x *cssTokenizer) currentToken() tokenizer.Token {
-	return x.currentTokenizer().Token()
-}
+// Returns the CSS of the token. This is the same as `Render`, except for custom property names and
+// the units of dimensions, which the tokenizer would otherwise escape.
+func (t *cssToken) render() string {
+	switch t.Type {
+	case tokenizer.TokenIdent:
+		if strings.HasPrefix(t.Value, "--") {
+			rest := tokenizer.Token{Type: tokenizer.TokenIdent, Value: t.Value[1:]}
+			return "-" + rest.Render()
+		}
 
-func (x *cssTokenizer) insertTokens(tokens string, filePath string, mixinName string) {
-	t := &cssTokenizers{
-		tokenizer: tokenizer.NewTokenizer(strings.NewReader(tokens)),
-		filePath:  filePath,
+	case tokenizer.TokenDimension:
+		// Units starting with "e" are escaped, so that they cannot be read as an exponent. But a
+		// unit of only letters is never read as one.
+		if unit := t.Extra.String(); strings.Trim(strings.ToLower(unit), "abcdefghijklmnopqrstuvwxyz") == "" {
+			return t.Value + unit
+		}
 	}
 
-	x.position = len(x.tokenizers)
-	x.tokenizers = append(x.tokenizers, t)
+	return t.Render()
 }
 
-// Fetch the mixin definition at the current token, and return its name and definition.
-func (x *cssTokenizer) parseMixinDefinition() (string, string) {
-	if x.nesting > 0 {
-		// @define-mixin must be declared at the root level. Pass it through as is.
-		return "", ""
-	}
-
-	var mixinIdent string
-	var original strings.Builder
+// Returns the offset in `input` at which the given `token` ends, when it starts at `offset`. The
+// tokenizer does not report positions, and renders some tokens differently to their source (eg.
+// whitespace is collapsed, and strings are always double quoted), so the source of those is scanned
+// instead.
+func tokenEnd(input string, offset int, token *tokenizer.Token) int {
+	rest := input[offset:]
 
-	// Iterate over all tokens until the next open brace to find the mixin name.
-	x.forEachToken(func(token *tokenizer.Token) bool {
-		original.WriteString(token.Render())
-
-		switch token.Type {
-		case tokenizer.TokenOpenBrace:
-			return false
+	switch token.Type {
+	case tokenizer.TokenS:
+		return offset + len(rest) - len(strings.TrimLeft(rest, " \t\n"))
 
-		case tokenizer.TokenIdent:
-			if mixinIdent == "" {
-				mixinIdent = token.Value
+	case tokenizer.TokenComment:
+		if i := strings.Index(rest[2:], "*/"); i >= 0 {
+			return offset + i + 4
+		}
+		return len(input)
+
+	case tokenizer.TokenString:
+		return offset + scanString(rest)
+
+	case tokenizer.TokenURI:
+		i := strings.IndexByte(rest, '(') + 1
+		for i < len(rest) {
+			switch rest[i] {
+			case '\\':
+				i += 2
+			case '"', '\'':
+				i += scanString(rest[i:])
+			case ')':
+				return offset + i + 1
+			default:
+				i++
 			}
 		}
+		return len(input)
+	}
+
+	rendered := (&cssToken{Token: *token}).render()
+	if len(rendered) <= len(rest) && strings.EqualFold(rest[:len(rendered)], rendered) {
+		return offset + len(rendered)
+	}
 
-		return true
-	})
+	// Escaped names render differently to their source, so scan the name instead.
+	i := 0
+	switch token.Type {
+	case tokenizer.TokenNumber, tokenizer.TokenPercentage, tokenizer.TokenDimension:
+		i = len(token.Value)
+	case tokenizer.TokenAtKeyword, tokenizer.TokenHash:
+		i = 1
+	}
 
-	if mixinIdent == "" {
-		// No ident found. Ignore it!
-		return "", ""
+	i += scanName(rest[i:])
+	if token.Type == tokenizer.TokenFunction {
+		i++
 	}
 
-	return mixinIdent, x.captureBlock(0)
+	return min(offset+i, len(input))
 }
 
-// Capture all output between the nest opening brace, until the closing brace at the given level.
-func (x *cssTokenizer) captureBlock(level int) string {
-	var content strings.Builder
+// Returns the length of the name at the start of `input`, including any escapes.
+func scanName(input string) int {
+	i := 0
 
-	x.forEachToken(func(token *tokenizer.Token) bool {
-		if token.Type == tokenizer.TokenOpenBrace && x.nesting == level {
-			content.Reset()
-			return true
-		}
+	for i < len(input) {
+		c := input[i]
 
-		if token.Type == tokenizer.TokenCloseBrace && x.nesting == level {
-			return false
+		switch {
+		case c == '\\':
+			i++
+			hex := 0
+			for i < len(input) && hex < 6 && isHexDigit(input[i]) {
+				i++
+				hex++
+			}
+			if hex == 0 {
+				i++
+			} else if i < len(input) && (input[i] == ' ' || input[i] == '\t' || input[i] == '\n') {
+				i++
+			}
+		case c == '-' || c == '_' || c >= 0x80 || (c >= '0' && c <= '9') || (c|0x20 >= 'a' && c|0x20 <= 'z'):
+			i++
+		default:
+			return i
 		}
+	}
 
-		content.WriteString(token.Render())
-		return true
-	})
-
-	return content.String()
+	return len(input)
 }
 
-// Iterate over all tokens, passing the given iterator function `iterFn` for each iteration.
-// Returning false from that function will break from the iteration.
-func (x *cssTokenizer) forEachToken(iterFn func(token *tokenizer.Token) bool) {
-	for {
-		token := x.currentToken()
-		iterResult := iterFn(&token)
-		if !iterResult {
-			break
-		}
-
-		x.next()
-	}
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c|0x20 >= 'a' && c|0x20 <= 'f')
 }
 
-func (x *cssTokenizer) log(msg string, args ...any) {
-	if !debug {
-		return
-	}
-
-	indent := strings.Repeat("..", x.nesting)
-	if indent != "" {
-		indent += " "
+// Returns the length of the quoted string at the start of `input`.
+func scanString(input string) int {
+	quote := input[0]
+
+	for i := 1; i < len(input); i++ {
+		switch input[i] {
+		case '\\':
+			i++
+		case quote:
+			return i + 1
+		case '\n':
+			return i
+		}
 	}
 
-	log.Printf("!%s%s", indent, fmt.Sprintf(msg, args...))
+	return len(input)
 }
 
-func (x *cssTokenizer) logOutput(output string) {
-	if !debug {
-		return
+// Returns the given `tokens` without leading and trailing whitespace and comments.
+func trimTokens(tokens []cssToken) []cssToken {
+	isSpace := func(token cssToken) bool {
+		return token.Type == tokenizer.TokenS || token.Type == tokenizer.TokenComment
 	}
 
-	indent := strings.Repeat("..", x.nesting)
-	if indent != "" {
-		indent += " "
+	for len(tokens) > 0 && isSpace(tokens[0]) {
+		tokens = tokens[1:]
+	}
+	for len(tokens) > 0 && isSpace(tokens[len(tokens)-1]) {
+		tokens = tokens[:len(tokens)-1]
 	}
 
-	log.Printf(" %s> %#v", indent, fmt.Sprint(output))
+	return tokens
 }
 
-func (x *cssTokenizer) logToken(args ...any) {
-	if !debug {
-		return
-	}
+// Splits the given `tokens` at each comma that is not within parentheses or brackets, and trims
+// each part.
+func splitTokens(tokens []cssToken) [][]cssToken {
+	var parts [][]cssToken
+	depth, start := 0, 0
 
-	indent := strings.Repeat("..", x.nesting)
-	if indent != "" {
-		indent += " "
+	for i, token := range tokens {
+		switch token.Type {
+		case tokenizer.TokenOpenParen, tokenizer.TokenOpenBracket, tokenizer.TokenFunction:
+			depth++
+		case tokenizer.TokenCloseParen, tokenizer.TokenCloseBracket:
+			depth = max(depth-1, 0)
+		case tokenizer.TokenComma:
+			if depth == 0 {
+				parts = append(parts, trimTokens(tokens[start:i]))
+				start = i + 1
+			}
+		}
 	}
 
-	if len(args) > 0 {
-		token := args[0].(tokenizer.Token)
-		log.Printf("!%s  [%s] %#v (p:%v)", indent, token.Type.String(), token.Value, x.position)
-	} else {
-		token := x.currentToken()
-		log.Printf(" %s  [%s] %#v (p:%v)", indent, token.Type.String(), token.Value, x.position)
-	}
+	return append(parts, trimTokens(tokens[start:]))
 }
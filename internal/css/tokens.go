@@ -0,0 +1,184 @@
+package css
+
+import (
+	"encoding/json"
+	"fmt"
+	"joelmoss/proscenium/internal/resolver"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/riking/cssparse/tokenizer"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// A design token, as a CSS custom property.
+type designToken struct {
+	name  string
+	value string
+}
+
+// Takes the given `@tokens` rule of `stylesheet`, and returns the design tokens of the JSON or YAML
+// file given by its url() as CSS custom properties: `@tokens url("/config/tokens.json");`. At the
+// root of the stylesheet, the custom properties are declared in a `:root` rule.
+func (p *cssParser) includeTokens(stylesheet *cssStylesheet, rule *cssAtRule, root bool) ([]cssNode, bool) {
+	prelude := trimTokens(rule.prelude)
+	if rule.block != nil || len(prelude) != 1 || prelude[0].Type != tokenizer.TokenURI {
+		p.addWarning(stylesheet, rule.name.cssSpan, "Expected a url() of a tokens file")
+		return nil, false
+	}
+
+	uri := prelude[0].Value
+	span := cssSpan{rule.start, prelude[0].end}
+
+	_, absPath, err := resolver.Resolve(p.config, uri, stylesheet.filePath)
+	if err != nil {
+		p.addWarning(stylesheet, span, "Could not resolve tokens file %q", uri)
+		return nil, false
+	}
+
+	tokens, invalid, err := readDesignTokens(absPath)
+	if err != nil {
+		p.addWarning(stylesheet, span, "Could not read tokens file %q: %s", uri, err)
+		return nil, false
+	}
+
+	for _, token := range invalid {
+		p.addWarning(stylesheet, span, "Ignored design token %q of %q: %s", token.name, uri, token.value)
+	}
+
+	p.addDependency(absPath)
+
+	var css strings.Builder
+	if root {
+		css.WriteString(":root {\n")
+	}
+	for _, token := range tokens {
+		name := cssToken{Token: tokenizer.Token{Type: tokenizer.TokenIdent, Value: token.name}}
+		fmt.Fprintf(&css, "%s: %s;\n", name.render(), token.value)
+	}
+	if root {
+		css.WriteString("}\n")
+	}
+
+	return parseGeneratedCss(css.String(), rule.name), true
+}
+
+// Reads the design tokens of the given JSON or YAML file. Nested groups of tokens are flattened
+// into a single custom property name, joined with "-", so `{ "color": { "primary": "red" } }`
+// becomes `--color-primary: red`. Tokens may also be given in the Design Tokens Community Group
+// format, where the value of each token is its "$value".
+//
+// Tokens that cannot be declared as a custom property, such as arrays, or strings that would end
+// the declaration, are returned separately, with the reason in place of their value.
+func readDesignTokens(filePath string) (tokens []designToken, invalid []designToken, err error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var values map[string]any
+
+	switch filepath.Ext(filePath) {
+	case ".json":
+		err = json.Unmarshal(data, &values)
+	case ".yml", ".yaml":
+		err = yaml.Unmarshal(data, &values)
+	default:
+		err = fmt.Errorf("unsupported file type %q", filepath.Ext(filePath))
+	}
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	flattenDesignTokens("-", values, &tokens, &invalid)
+
+	return tokens, invalid, nil
+}
+
+func flattenDesignTokens(name string, value any, tokens *[]designToken, invalid *[]designToken) {
+	switch v := value.(type) {
+	case map[string]any:
+		if tokenValue, ok := v["$value"]; ok {
+			flattenDesignTokens(name, tokenValue, tokens, invalid)
+			return
+		}
+
+		for _, key := range slices.Sorted(maps.Keys(v)) {
+			// Keys starting with "$" are properties of a group, such as "$type" or "$description".
+			if !strings.HasPrefix(key, "$") {
+				flattenDesignTokens(name+"-"+key, v[key], tokens, invalid)
+			}
+		}
+
+	case string:
+		if reason := invalidTokenValue(v); reason != "" {
+			*invalid = append(*invalid, designToken{name, reason})
+		} else {
+			*tokens = append(*tokens, designToken{name, v})
+		}
+
+	case int, int64, float64, bool:
+		*tokens = append(*tokens, designToken{name, fmt.Sprint(v)})
+
+	case []any:
+		*invalid = append(*invalid, designToken{name, "arrays are not supported"})
+
+	case nil:
+		*invalid = append(*invalid, designToken{name, "a value is required"})
+
+	default:
+		*invalid = append(*invalid, designToken{name, fmt.Sprintf("values of type %T are not supported", v)})
+	}
+}
+
+// Returns why the given `value` cannot be the value of a custom property, or an empty string if it
+// can. Values must not end the declaration or its rule, so semicolons and "!" are only allowed
+// within brackets, and all brackets and strings must be closed.
+func invalidTokenValue(value string) string {
+	var closers []tokenizer.TokenType
+
+	for _, token := range tokenize(value) {
+		switch token.Type {
+		case tokenizer.TokenEOF:
+			if len(closers) > 0 {
+				return "unclosed brackets"
+			}
+			return ""
+
+		case tokenizer.TokenFunction, tokenizer.TokenOpenParen:
+			closers = append(closers, tokenizer.TokenCloseParen)
+		case tokenizer.TokenOpenBracket:
+			closers = append(closers, tokenizer.TokenCloseBracket)
+		case tokenizer.TokenOpenBrace:
+			closers = append(closers, tokenizer.TokenCloseBrace)
+
+		case tokenizer.TokenCloseParen, tokenizer.TokenCloseBracket, tokenizer.TokenCloseBrace:
+			if len(closers) == 0 || closers[len(closers)-1] != token.Type {
+				return "unbalanced brackets"
+			}
+			closers = closers[:len(closers)-1]
+
+		case tokenizer.TokenSemicolon:
+			if len(closers) == 0 {
+				return "semicolons are only allowed within brackets"
+			}
+		case tokenizer.TokenDelim:
+			if token.Value == "!" && len(closers) == 0 {
+				return `"!" is only allowed within brackets`
+			}
+
+		case tokenizer.TokenString:
+			if quote := value[token.start]; token.end-token.start < 2 || value[token.end-1] != quote {
+				return "unclosed string"
+			}
+		case tokenizer.TokenBadString, tokenizer.TokenBadURI, tokenizer.TokenBadEscape:
+			return "invalid string, url or escape"
+		}
+	}
+
+	return "invalid value"
+}
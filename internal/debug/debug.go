@@ -7,18 +7,25 @@ import (
 	"path"
 	"runtime"
 	"strings"
+	"sync/atomic"
 
 	"github.com/k0kubun/pp"
 )
 
-var Enabled = false
+var enabled atomic.Bool
 
+// Enables debug output, such as when a config with `Debug` set is parsed. As configs are passed to
+// each build explicitly, this is how their `Debug` option takes effect.
 func Enable() {
-	Enabled = true
+	enabled.Store(true)
+}
+
+func Disable() {
+	enabled.Store(false)
 }
 
 func Debug(args ...any) {
-	if types.Config.Debug || Enabled {
+	if types.Config.Debug || enabled.Load() {
 		cwd, _ := os.Getwd()
 		_, fn, line, _ := runtime.Caller(1)
 
@@ -1,63 +1,99 @@
 package plugin
 
 import (
+	"encoding/json"
 	"fmt"
 	"joelmoss/proscenium/internal/css"
 	"joelmoss/proscenium/internal/debug"
 	"joelmoss/proscenium/internal/types"
 	"joelmoss/proscenium/internal/utils"
+	"maps"
+	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
-
+	"sync"
 
 	esbuild "github.com/joelmoss/esbuild-internal/api"
 	"github.com/joelmoss/esbuild-internal/ast"
 )
 
-var Css = esbuild.Plugin{
-	Name: "Css",
-	Setup: func(build esbuild.PluginBuild) {
-		build.OnLoad(esbuild.OnLoadOptions{Filter: `\.css$`},
-			func(args esbuild.OnLoadArgs) (esbuild.OnLoadResult, error) {
-				debug.Debug("OnLoad:begin", args)
+func Css(config *types.ConfigT) esbuild.Plugin {
+	return esbuild.Plugin{
+		Name: "Css",
+		Setup: func(build esbuild.PluginBuild) {
+			assets := &cssModuleAssets{}
 
-				var pluginData types.PluginData
-				if args.PluginData != nil {
-					pluginData = args.PluginData.(types.PluginData)
-				}
+			build.OnStart(func() (esbuild.OnStartResult, error) {
+				assets.reset()
+				return esbuild.OnStartResult{}, nil
+			})
 
-				if args.Namespace == "rubygems" && pluginData.RealPath != "" {
-					args.Path = pluginData.RealPath
-				}
+			build.OnEnd(func(result *esbuild.BuildResult) (esbuild.OnEndResult, error) {
+				return esbuild.OnEndResult{}, assets.addTo(build.InitialOptions, result)
+			})
 
-				isCssModule := utils.PathIsCssModule(args.Path)
+			build.OnLoad(esbuild.OnLoadOptions{Filter: `\.css$`},
+				func(args esbuild.OnLoadArgs) (esbuild.OnLoadResult, error) {
+					debug.Debug("OnLoad:begin", args)
 
-				// If stylesheet is imported from JS, then we return JS code that appends the stylesheet
-				// contents in a <style> tag in the <head> of the page, and if the stylesheet is a CSS
-				// module, it exports a plain object of class names.
-				if pluginData.ImportedFromJs && isCssModule {
-					urlPath := buildUrlPath(args.Path)
-					cssResult := cssBuild(urlPath[1:])
-					if len(cssResult.Errors) != 0 {
-						return esbuild.OnLoadResult{
-							Errors:   cssResult.Errors,
-							Warnings: cssResult.Warnings,
-						}, fmt.Errorf("%s", cssResult.Errors[0].Text)
+					var pluginData types.PluginData
+					if args.PluginData != nil {
+						pluginData = args.PluginData.(types.PluginData)
 					}
 
-					if len(cssResult.OutputFiles) > 1 {
-						return esbuild.OnLoadResult{}, fmt.Errorf("Multiple output files generated for %s", args.Path)
+					if args.Namespace == "rubygems" && pluginData.RealPath != "" {
+						args.Path = pluginData.RealPath
 					}
 
-					hash := ast.CssLocalHash(args.Path)
-					hashIdent := hash
-					if !build.InitialOptions.MinifyIdentifiers {
-						relPath, _ := filepath.Rel(build.InitialOptions.AbsWorkingDir, args.Path)
-						hashIdent = hashIdent + "_" + ast.CssLocalAppendice(relPath)
+					isCssModule := utils.PathIsCssModule(args.Path)
+
+					// When rendering on the server, stylesheets imported from JS are never appended to the
+					// page, so CSS modules only export their class names, and plain stylesheets are empty.
+					if pluginData.ImportedFromJs && config.Ssr {
+						contents := ""
+						if isCssModule && config.CssModuleExports {
+							module, result, err := buildCssModule(config, args.Path)
+							if module == nil {
+								return result, err
+							}
+
+							contents = cssModuleExportsTemplate(module.names, unknownCssModuleImports(args.Suffix))
+						} else if isCssModule {
+							contents = cssModulesProxyTemplate(cssModuleHashIdent(build, args.Path))
+						}
+
+						return esbuild.OnLoadResult{
+							Contents:   &contents,
+							ResolveDir: config.RootPath,
+							Loader:     esbuild.LoaderJS,
+						}, nil
 					}
 
-					contents := strings.TrimSpace(string(cssResult.OutputFiles[0].Contents))
-					contents = `
+					// If stylesheet is imported from JS, then we return JS code that appends the stylesheet
+					// contents in a <style> tag in the <head> of the page, and if the stylesheet is a CSS
+					// module, it exports a plain object of class names.
+					if pluginData.ImportedFromJs && isCssModule {
+						module, result, err := buildCssModule(config, args.Path)
+						if module == nil {
+							return result, err
+						}
+
+						assets.add(module.assets)
+
+						urlPath := buildUrlPath(config, args.Path)
+						hash := ast.CssLocalHash(args.Path)
+						hashIdent := cssModuleHashIdent(build, args.Path)
+
+						exports := cssModulesProxyTemplate(hashIdent)
+						if config.CssModuleExports {
+							exports = cssModuleExportsTemplate(module.names, unknownCssModuleImports(args.Suffix))
+						}
+
+						contents := strings.TrimSpace(string(module.stylesheet))
+						contents = `
 							const d = document;
 							const u = '` + urlPath + `';
 							const es = d.querySelector('#_` + hash + `');
@@ -74,61 +110,71 @@ var Css = esbuild.Plugin{
 								const ps = d.head.querySelector('[data-proscenium-style]');
 								ps ? d.head.insertBefore(e, ps) : d.head.appendChild(e);
 							}
-							` + cssModulesProxyTemplate(hashIdent)
+							` + exports
 
-					debug.Debug("OnLoad:end", args)
+						debug.Debug("OnLoad:end", args)
 
-					return esbuild.OnLoadResult{
-						Contents:   &contents,
-						ResolveDir: types.Config.RootPath,
-						Loader:     esbuild.LoaderJS,
-					}, nil
-				}
+						return esbuild.OnLoadResult{
+							Contents:   &contents,
+							ResolveDir: config.RootPath,
+							Loader:     esbuild.LoaderJS,
+							WatchFiles: FileDependencies(args.Path),
+						}, nil
+					}
 
-				contents, warnings, err := css.ParseCssFile(args.Path)
-				if err != nil {
-					return esbuild.OnLoadResult{}, err
-				}
+					contents, warnings, deps, err := css.ParseCssFile(config, args.Path)
+					if err != nil {
+						return esbuild.OnLoadResult{}, err
+					}
 
-				loader := esbuild.LoaderCSS
-				if isCssModule {
-					loader = esbuild.LoaderLocalCSS
-				}
+					setDependencies(args.Path, deps)
 
-				return esbuild.OnLoadResult{
-					Contents: &contents,
-					Loader:   loader,
-					Warnings: cssWarningsToMessages(warnings),
-				}, nil
-			})
-	},
+					loader := esbuild.LoaderCSS
+					if isCssModule {
+						loader = esbuild.LoaderLocalCSS
+					}
+
+					return esbuild.OnLoadResult{
+						Contents:   &contents,
+						Loader:     loader,
+						Warnings:   cssWarningsToMessages(warnings),
+						WatchFiles: FileDependencies(args.Path),
+					}, nil
+				})
+		},
+	}
 }
 
-var cssOnly = esbuild.Plugin{
-	Name: "cssOnly",
-	Setup: func(build esbuild.PluginBuild) {
-		// Parse CSS files.
-		build.OnLoad(esbuild.OnLoadOptions{Filter: `\.css$`},
-			func(args esbuild.OnLoadArgs) (esbuild.OnLoadResult, error) {
-				debug.Debug("cssOnly.OnLoad", args)
+func cssOnly(config *types.ConfigT) esbuild.Plugin {
+	return esbuild.Plugin{
+		Name: "cssOnly",
+		Setup: func(build esbuild.PluginBuild) {
+			// Parse CSS files.
+			build.OnLoad(esbuild.OnLoadOptions{Filter: `\.css$`},
+				func(args esbuild.OnLoadArgs) (esbuild.OnLoadResult, error) {
+					debug.Debug("cssOnly.OnLoad", args)
 
-				contents, warnings, err := css.ParseCssFile(args.Path)
-				if err != nil {
-					return esbuild.OnLoadResult{}, err
-				}
+					contents, warnings, deps, err := css.ParseCssFile(config, args.Path)
+					if err != nil {
+						return esbuild.OnLoadResult{}, err
+					}
 
-				loader := esbuild.LoaderCSS
-				if utils.PathIsCssModule(args.Path) {
-					loader = esbuild.LoaderLocalCSS
-				}
+					setDependencies(args.Path, deps)
 
-				return esbuild.OnLoadResult{
-					Contents: &contents,
-					Loader:   loader,
-					Warnings: cssWarningsToMessages(warnings),
-				}, nil
-			})
-	},
+					loader := esbuild.LoaderCSS
+					if utils.PathIsCssModule(args.Path) {
+						loader = esbuild.LoaderLocalCSS
+					}
+
+					return esbuild.OnLoadResult{
+						Contents:   &contents,
+						Loader:     loader,
+						Warnings:   cssWarningsToMessages(warnings),
+						WatchFiles: FileDependencies(args.Path),
+					}, nil
+				})
+		},
+	}
 }
 
 func cssWarningsToMessages(warnings []css.CssWarning) []esbuild.Message {
@@ -153,13 +199,42 @@ func cssWarningsToMessages(warnings []css.CssWarning) []esbuild.Message {
 	return msgs
 }
 
-func buildUrlPath(fsPath string) string {
-	gemName, gemPath, found := utils.PathIsRubyGem(fsPath)
+// Returns the absolute paths of all file inputs in the given `metafile`, except `exclude`.
+func metafileInputs(metafile string, exclude string) []string {
+	var metadata struct{ Inputs map[string]any }
+	if err := json.Unmarshal([]byte(metafile), &metadata); err != nil {
+		return nil
+	}
+
+	inputs := make([]string, 0, len(metadata.Inputs))
+	for input := range metadata.Inputs {
+		if input != exclude && filepath.IsAbs(input) {
+			inputs = append(inputs, input)
+		}
+	}
+
+	return inputs
+}
+
+func buildUrlPath(config *types.ConfigT, fsPath string) string {
+	gemName, gemPath, found := utils.PathIsRubyGem(config, fsPath)
 	if found {
 		return "/node_modules/" + types.RubyGemsScope + gemName + strings.TrimPrefix(fsPath, gemPath)
 	} else {
-		return strings.TrimPrefix(fsPath, types.Config.RootPath)
+		return strings.TrimPrefix(fsPath, config.RootPath)
+	}
+}
+
+// Returns the suffix appended to each class name of the CSS module at the given `path`, which is
+// the same as that generated by esbuild.
+func cssModuleHashIdent(build esbuild.PluginBuild, path string) string {
+	hashIdent := ast.CssLocalHash(path)
+	if !build.InitialOptions.MinifyIdentifiers {
+		relPath, _ := filepath.Rel(build.InitialOptions.AbsWorkingDir, path)
+		hashIdent = hashIdent + "_" + ast.CssLocalAppendice(relPath)
 	}
+
+	return hashIdent
 }
 
 func cssModulesProxyTemplate(hash string) string {
@@ -172,37 +247,392 @@ func cssModulesProxyTemplate(hash string) string {
 	`
 }
 
-// Build the given `urlPath`
-func cssBuild(urlPath string) esbuild.BuildResult {
-	minify := !types.Config.InternalTesting && !types.Config.Debug && types.Config.Environment != types.DevEnv
+// Matches the properties of a JS object literal whose values are strings, such as `button: "a"` and
+// `"nav-item": "b"`.
+var jsStringPropertyRegexp = regexp.MustCompile(`([_$a-zA-Z][_$\w]*|"(?:[^"\\]|\\.)*")\s*:\s*("(?:[^"\\]|\\.)*")`)
+
+// Matches names that can be exported with `export const`.
+var jsIdentRegexp = regexp.MustCompile(`^[_$a-zA-Z][_$\w]*$`)
+
+var jsReservedWords = []string{
+	"await", "break", "case", "catch", "class", "const", "continue", "debugger", "default", "delete",
+	"do", "else", "enum", "export", "extends", "false", "finally", "for", "function", "if",
+	"implements", "import", "in", "instanceof", "interface", "let", "new", "null", "package",
+	"private", "protected", "public", "return", "static", "super", "switch", "this", "throw", "true",
+	"try", "typeof", "var", "void", "while", "with", "yield",
+}
+
+// Exports the given local `names` of a CSS module as named exports, and as a default export of a
+// plain object. Unlike the Proxy of `cssModulesProxyTemplate`, unused class names can be tree
+// shaken. Class names that are not valid JS identifiers, such as "nav-item", are only available
+// from the default export. Each of the `unknown` names imported by name is exported as undefined,
+// so that it is reported as a warning by `checkCssModuleImports`, instead of failing the build.
+func cssModuleExportsTemplate(names map[string]string, unknown []string) string {
+	var contents strings.Builder
+	for _, name := range slices.Sorted(maps.Keys(names)) {
+		if isJsExportName(name) {
+			fmt.Fprintf(&contents, "export const %s = %q;\n", name, names[name])
+		}
+	}
+
+	for _, name := range unknown {
+		if _, exists := names[name]; !exists && isJsExportName(name) {
+			fmt.Fprintf(&contents, "export const %s = undefined;\n", name)
+		}
+	}
+
+	defaultExport, _ := json.Marshal(names)
+	fmt.Fprintf(&contents, "export default %s;\n", defaultExport)
+
+	return contents.String()
+}
+
+func isJsExportName(name string) bool {
+	return jsIdentRegexp.MatchString(name) && !slices.Contains(jsReservedWords, name)
+}
+
+// Warns of each name imported from a CSS module by the importer of the given resolve `args`, that
+// the module does not export, when `CssModuleExports` is enabled. As esbuild loads each path only
+// once, the `result` of importers with unknown names is given a suffix listing them, so that each
+// loads its own copy of the module, which exports those names as undefined.
+func checkCssModuleImports(config *types.ConfigT, args esbuild.OnResolveArgs, result *esbuild.OnResolveResult) {
+	if !config.CssModuleExports || result.External || !filepath.IsAbs(result.Path) ||
+		!utils.PathIsCssModule(result.Path) {
+		return
+	}
+
+	source, err := os.ReadFile(args.Importer)
+	if err != nil {
+		return
+	}
+
+	imports := namedImports(string(source), args.Path)
+	if len(imports) == 0 {
+		return
+	}
+
+	// Errors are reported when the module itself is loaded.
+	module, _, _ := buildCssModule(config, result.Path)
+	if module == nil {
+		return
+	}
+
+	var unknown []string
+	for _, namedImport := range imports {
+		if _, exists := module.names[namedImport.name]; exists || slices.Contains(unknown, namedImport.name) {
+			continue
+		}
+
+		unknown = append(unknown, namedImport.name)
+		result.Warnings = append(result.Warnings, esbuild.Message{
+			Text:     fmt.Sprintf("No matching class name in %q for import %q", args.Path, namedImport.name),
+			Location: sourceLocation(args.Importer, string(source), namedImport.offset, len(namedImport.name)),
+		})
+	}
+
+	if len(unknown) > 0 {
+		slices.Sort(unknown)
+		result.Suffix = unknownImportsSuffix + strings.Join(unknown, ",")
+	}
+}
+
+const unknownImportsSuffix = "?unknown="
+
+// Returns the unknown names listed in the given `suffix` by `checkCssModuleImports`.
+func unknownCssModuleImports(suffix string) []string {
+	if names, ok := strings.CutPrefix(suffix, unknownImportsSuffix); ok {
+		return strings.Split(names, ",")
+	}
+
+	return nil
+}
+
+// A name imported by an import statement, and its byte offset within the source.
+type namedImport struct {
+	name   string
+	offset int
+}
 
-	return esbuild.Build(esbuild.BuildOptions{
+// Matches the named imports of an import statement, and its specifier.
+var namedImportsRegexp = regexp.MustCompile(`\bimport\s+(?:[_$\w]+\s*,\s*)?\{([^}]*)\}\s*from\s*["']([^"']+)["']`)
+
+// Returns the names imported from the given `specifier` by the import statements of `source`. Type
+// imports and default imports are not included.
+func namedImports(source string, specifier string) []namedImport {
+	var imports []namedImport
+
+	for _, match := range namedImportsRegexp.FindAllStringSubmatchIndex(source, -1) {
+		if source[match[4]:match[5]] != specifier {
+			continue
+		}
+
+		offset := match[2]
+		for part := range strings.SplitSeq(source[match[2]:match[3]], ",") {
+			fields := strings.Fields(part)
+			if len(fields) > 0 && fields[0] != "default" && fields[0] != "type" {
+				imports = append(imports, namedImport{fields[0], offset + strings.Index(part, fields[0])})
+			}
+			offset += len(part) + 1
+		}
+	}
+
+	return imports
+}
+
+// Returns the location of the `length` bytes at `offset` within the `source` of the file at
+// `filePath`.
+func sourceLocation(filePath string, source string, offset int, length int) *esbuild.Location {
+	lineStart := strings.LastIndexByte(source[:offset], '\n') + 1
+	lineEnd := strings.IndexByte(source[offset:], '\n')
+	if lineEnd == -1 {
+		lineEnd = len(source)
+	} else {
+		lineEnd += offset
+	}
+
+	return &esbuild.Location{
+		File:      filePath,
+		Namespace: "file",
+		Line:      strings.Count(source[:offset], "\n") + 1,
+		Column:    offset - lineStart,
+		Length:    length,
+		LineText:  source[lineStart:lineEnd],
+	}
+}
+
+// A CSS module that is imported from JS, built by `buildCssModule`.
+type cssModule struct {
+	// The compiled stylesheet.
+	stylesheet []byte
+
+	// The assets referenced by the stylesheet, such as the images and fonts of `BundleAssets`.
+	assets []esbuild.OutputFile
+
+	// The local names of the module, mapped to their class names. This is the map that esbuild
+	// exports when the module is imported from JS, so it includes the names of keyframes, and the
+	// class names that each local name composes, separated by a space.
+	names map[string]string
+
+	// The hash of the config that the module was built with, and the stamps of the module and each
+	// file that it depends on, as of that build.
+	configHash string
+	stamps     map[string]fileStamp
+}
+
+// The last build of each CSS module, keyed by its absolute path. A module is imported by many files,
+// and its names are checked as each import is resolved, so it is only built again once the config,
+// or any of the files it depends on have changed.
+var cssModules sync.Map
+
+// Builds the CSS module at the given `path`, unless its last build is still fresh. If the build
+// fails, the module is nil, and the result and error should be returned from OnLoad.
+func buildCssModule(config *types.ConfigT, path string) (*cssModule, esbuild.OnLoadResult, error) {
+	configHash := config.Hash()
+
+	if cached, ok := cssModules.Load(path); ok {
+		module := cached.(*cssModule)
+		if module.configHash == configHash && !stampsChanged(module.stamps) {
+			return module, esbuild.OnLoadResult{}, nil
+		}
+	}
+
+	// The module is imported by JS, by the same path that it is served from, relative to the root,
+	// so that esbuild builds both the stylesheet, and the JS object of its local names.
+	specifier := buildUrlPath(config, path)[1:]
+	if !utils.IsRubyGem(strings.TrimPrefix(specifier, "node_modules/")) {
+		specifier = "./" + specifier
+	}
+
+	result := cssBuild(config, "", &esbuild.StdinOptions{
+		Contents:   fmt.Sprintf("export { default } from %q;", specifier),
+		ResolveDir: config.RootPath,
+		Loader:     esbuild.LoaderJS,
+	})
+	if len(result.Errors) != 0 {
+		return nil, esbuild.OnLoadResult{
+			Errors:   result.Errors,
+			Warnings: result.Warnings,
+		}, fmt.Errorf("%s", result.Errors[0].Text)
+	}
+
+	module := &cssModule{names: map[string]string{}, configHash: configHash}
+
+	for _, output := range result.OutputFiles {
+		switch {
+		case utils.PathIsCss(output.Path):
+			module.stylesheet = output.Contents
+		case filepath.Ext(output.Path) == ".js":
+			for _, match := range jsStringPropertyRegexp.FindAllStringSubmatch(string(output.Contents), -1) {
+				name, value := match[1], match[2]
+				if strings.HasPrefix(name, `"`) {
+					name, _ = strconv.Unquote(name)
+				}
+
+				if value, err := strconv.Unquote(value); err == nil && name != "" {
+					module.names[name] = value
+				}
+			}
+		default:
+			module.assets = append(module.assets, output)
+		}
+	}
+
+	setDependencies(path, metafileInputs(result.Metafile, path))
+
+	// Modules that cannot be stamped are built again when next used.
+	module.stamps = stampFiles(append([]string{path}, FileDependencies(path)...))
+	if module.stamps != nil {
+		cssModules.Store(path, module)
+	} else {
+		cssModules.Delete(path)
+	}
+
+	return module, esbuild.OnLoadResult{}, nil
+}
+
+// The assets referenced by the CSS modules imported from JS during a build. As CSS modules are
+// built separately, their assets are not outputs of the build that imports them, so are added to
+// its result when it ends. That way they are written, listed in the manifest, and retained, along
+// with the other outputs of the build.
+type cssModuleAssets struct {
+	mutex sync.Mutex
+	files map[string]esbuild.OutputFile
+}
+
+func (a *cssModuleAssets) reset() {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	clear(a.files)
+}
+
+func (a *cssModuleAssets) add(files []esbuild.OutputFile) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.files == nil {
+		a.files = make(map[string]esbuild.OutputFile, len(files))
+	}
+
+	for _, file := range files {
+		a.files[file.Path] = file
+	}
+}
+
+// Adds each asset that is not already an output to the output files and metafile of the given
+// `result`, writing them if the build `options` write their outputs.
+func (a *cssModuleAssets) addTo(options *esbuild.BuildOptions, result *esbuild.BuildResult) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if len(a.files) == 0 || len(result.Errors) != 0 {
+		return nil
+	}
+
+	var metadata map[string]any
+	if result.Metafile != "" {
+		if err := json.Unmarshal([]byte(result.Metafile), &metadata); err != nil {
+			return err
+		}
+	}
+	outputs, _ := metadata["outputs"].(map[string]any)
+
+	for _, outputPath := range slices.Sorted(maps.Keys(a.files)) {
+		if slices.ContainsFunc(result.OutputFiles, func(output esbuild.OutputFile) bool {
+			return output.Path == outputPath
+		}) {
+			continue
+		}
+
+		file := a.files[outputPath]
+
+		if options.Write {
+			if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+				return err
+			}
+			if err := os.WriteFile(outputPath, file.Contents, 0644); err != nil {
+				return err
+			}
+		}
+
+		result.OutputFiles = append(result.OutputFiles, file)
+
+		if outputs != nil {
+			key := outputPath
+			if options.AbsPaths&esbuild.MetafileAbsPath == 0 {
+				if relPath, err := filepath.Rel(options.AbsWorkingDir, outputPath); err == nil {
+					key = filepath.ToSlash(relPath)
+				}
+			}
+
+			outputs[key] = map[string]any{
+				"imports": []any{},
+				"exports": []any{},
+				"inputs":  map[string]any{},
+				"bytes":   len(file.Contents),
+			}
+		}
+	}
+
+	if outputs != nil {
+		data, err := json.Marshal(metadata)
+		if err != nil {
+			return err
+		}
+		result.Metafile = string(data)
+	}
+
+	return nil
+}
+
+// Build the given `urlPath`, or the `stdin` contents when given.
+func cssBuild(config *types.ConfigT, urlPath string, stdin *esbuild.StdinOptions) esbuild.BuildResult {
+	minify := !config.InternalTesting && !config.Debug && config.Environment != types.DevEnv
+
+	buildOptions := esbuild.BuildOptions{
 		EntryPoints:                 []string{urlPath},
-		AbsWorkingDir:               types.Config.RootPath,
+		AbsWorkingDir:               config.RootPath,
 		LogLevel:                    esbuild.LogLevelSilent,
 		LogLimit:                    1,
-		Outdir:                      types.Config.OutputDir,
+		Outdir:                      config.OutputDir,
 		Outbase:                     "./",
+		AssetNames:                  "[dir]/[name]-$[hash]$",
 		MinifyWhitespace:            minify,
 		MinifyIdentifiers:           minify,
 		MinifySyntax:                minify,
 		DeterministicLocalCSSNaming: true,
 		Bundle:                      true,
-		External:                    types.Config.External,
-		Conditions:                  []string{types.Config.Environment.String(), "proscenium"},
+		External:                    config.External,
+		Conditions:                  []string{config.Environment.String(), "proscenium"},
 		Write:                       false,
+		Metafile:                    true,
+		AbsPaths:                    esbuild.MetafileAbsPath,
 		Sourcemap:                   esbuild.SourceMapNone,
 		LegalComments:               esbuild.LegalCommentsNone,
-		Plugins:                     []esbuild.Plugin{Bundler, Svg, cssOnly},
-		Target:                      esbuild.ES2022,
-		Supported: map[string]bool{
-			// Ensure CSS  esting is transformed for browsers that don't support it.
-			"nesting": false,
-		},
+		Plugins:                     []esbuild.Plugin{Bundler(config), Svg, cssOnly(config)},
 
 		// The Esbuild default places browser before module, but we're building for modern browsers
 		// which support esm. So we prioritise that. Some libraries export a "browser" build that still
 		// uses CJS.
 		MainFields: []string{"module", "browser", "main"},
-	})
+	}
+
+	if stdin != nil {
+		buildOptions.EntryPoints = nil
+		buildOptions.Stdin = stdin
+	}
+
+	if err := utils.ApplyTargets(config, &buildOptions); err != nil {
+		return esbuild.BuildResult{
+			Errors: []esbuild.Message{{Text: "Invalid targets", Detail: err.Error()}},
+		}
+	}
+
+	if err := utils.ApplyLoaders(config, &buildOptions); err != nil {
+		return esbuild.BuildResult{
+			Errors: []esbuild.Message{{Text: "Invalid loaders", Detail: err.Error()}},
+		}
+	}
+
+	return esbuild.Build(buildOptions)
 }
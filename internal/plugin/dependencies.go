@@ -0,0 +1,86 @@
+package plugin
+
+import (
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Files that a loaded file depends on, but which esbuild knows nothing about, such as CSS mixin
+// files, or the stylesheets bundled into a CSS module that is imported from JS. Keyed by the
+// absolute path of the loaded file.
+var dependencies sync.Map
+
+// Records the given `deps` as the dependencies of the file at `path`, replacing any that were
+// previously recorded.
+func setDependencies(path string, deps []string) {
+	if len(deps) == 0 {
+		dependencies.Delete(path)
+		return
+	}
+
+	dependencies.Store(path, slices.Clone(deps))
+}
+
+// Returns the absolute paths of all files that the file at `path` depends on, including those of
+// its dependencies.
+func FileDependencies(path string) []string {
+	var result []string
+	seen := map[string]bool{path: true}
+	queue := []string{path}
+
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		deps, ok := dependencies.Load(current)
+		if !ok {
+			continue
+		}
+
+		for _, dep := range deps.([]string) {
+			if !seen[dep] {
+				seen[dep] = true
+				result = append(result, dep)
+				queue = append(queue, dep)
+			}
+		}
+	}
+
+	return result
+}
+
+// The modification time and size of a file or directory, so that changes to it can be detected.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// Stamps each of the given `paths`. Returns nil if any of them cannot be stamped.
+func stampFiles(paths []string) map[string]fileStamp {
+	stamps := make(map[string]fileStamp, len(paths))
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil
+		}
+
+		stamps[path] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+	}
+
+	return stamps
+}
+
+// Returns true if any of the given `stamps` no longer match the file system.
+func stampsChanged(stamps map[string]fileStamp) bool {
+	for path, stamp := range stamps {
+		info, err := os.Stat(path)
+		if err != nil || !info.ModTime().Equal(stamp.modTime) || info.Size() != stamp.size {
+			return true
+		}
+	}
+
+	return false
+}
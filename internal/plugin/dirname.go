@@ -13,38 +13,40 @@ import (
 
 // Dirname provides `__filename` and `__dirname` constants to JS/TS files, similar to Node.js. The
 // values are root-relative paths with a leading `/`, or resolved URL paths for rubygem files.
-var Dirname = api.Plugin{
-	Name: "dirname",
-	Setup: func(build api.PluginBuild) {
-		build.OnLoad(api.OnLoadOptions{Filter: `\.(jsx?|tsx?)$`},
-			func(args api.OnLoadArgs) (api.OnLoadResult, error) {
-				debug.Debug("OnLoad:begin", args)
-
-				// Skip npm packages in node_modules.
-				if strings.Contains(args.Path, "/node_modules/") {
-					debug.Debug(strings.Contains(args.Path, "/node_modules/"))
-					return api.OnLoadResult{}, nil
-				}
-
-				var relPath string
-
-				if gemName, gemPath, ok := utils.PathIsRubyGem(args.Path); ok {
-					// Rubygem file — use @rubygems/<name>/... path.
-					suffix := strings.TrimPrefix(args.Path, gemPath)
-					relPath = types.RubyGemsScope + gemName + suffix
-				} else if cutPath, ok := strings.CutPrefix(args.Path, types.Config.RootPath); ok {
-					// File inside the project root — use root-relative path.
-					relPath = cutPath
-				} else {
-					return api.OnLoadResult{}, nil
-				}
-
-				dir := path.Dir(relPath)
-				prepend := fmt.Sprintf("const __filename = %q, __dirname = %q;\n", relPath, dir)
-
-				return api.OnLoadResult{
-					Prepend: &prepend,
-				}, nil
-			})
-	},
+func Dirname(config *types.ConfigT) api.Plugin {
+	return api.Plugin{
+		Name: "dirname",
+		Setup: func(build api.PluginBuild) {
+			build.OnLoad(api.OnLoadOptions{Filter: `\.(jsx?|tsx?)$`},
+				func(args api.OnLoadArgs) (api.OnLoadResult, error) {
+					debug.Debug("OnLoad:begin", args)
+
+					// Skip npm packages in node_modules.
+					if strings.Contains(args.Path, "/node_modules/") {
+						debug.Debug(strings.Contains(args.Path, "/node_modules/"))
+						return api.OnLoadResult{}, nil
+					}
+
+					var relPath string
+
+					if gemName, gemPath, ok := utils.PathIsRubyGem(config, args.Path); ok {
+						// Rubygem file — use @rubygems/<name>/... path.
+						suffix := strings.TrimPrefix(args.Path, gemPath)
+						relPath = types.RubyGemsScope + gemName + suffix
+					} else if cutPath, ok := strings.CutPrefix(args.Path, config.RootPath); ok {
+						// File inside the project root — use root-relative path.
+						relPath = cutPath
+					} else {
+						return api.OnLoadResult{}, nil
+					}
+
+					dir := path.Dir(relPath)
+					prepend := fmt.Sprintf("const __filename = %q, __dirname = %q;\n", relPath, dir)
+
+					return api.OnLoadResult{
+						Prepend: &prepend,
+					}, nil
+				})
+		},
+	}
 }
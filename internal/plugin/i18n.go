@@ -6,6 +6,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	esbuild "github.com/joelmoss/esbuild-internal/api"
@@ -53,128 +54,147 @@ func camelCaseKeys(v any) any {
 	}
 }
 
-var (
-	i18nCachedResult *string
-	i18nFileMtimes   map[string]time.Time
-	i18nDirMtime     time.Time
-)
+// The cached JSON of the locale files in a single locales directory.
+type i18nCache struct {
+	mutex      sync.Mutex
+	result     *string
+	fileMtimes map[string]time.Time
+	dirMtime   time.Time
+}
 
-var I18n = esbuild.Plugin{
-	Name: "i18n",
-	Setup: func(build esbuild.PluginBuild) {
-		cwd := build.InitialOptions.AbsWorkingDir
-		root := filepath.Join(cwd, "config", "locales")
-
-		build.OnResolve(esbuild.OnResolveOptions{Filter: `^proscenium/i18n$`},
-			func(args esbuild.OnResolveArgs) (esbuild.OnResolveResult, error) {
-				return esbuild.OnResolveResult{
-					Path:      args.Path,
-					Namespace: "i18n",
-				}, nil
-			})
-
-		build.OnLoad(esbuild.OnLoadOptions{Filter: `\.*`, Namespace: "i18n"},
-			func(args esbuild.OnLoadArgs) (esbuild.OnLoadResult, error) {
-				// In production, return cached result immediately if available.
-				if types.Config.Environment == types.ProdEnv && i18nCachedResult != nil {
-					return esbuild.OnLoadResult{
-						Contents: i18nCachedResult,
-						Loader:   esbuild.LoaderJSON,
+// Returns the cached result, watching the locales directory and each of its locale files, so that
+// watch mode rebuilds when they change.
+func (cache *i18nCache) loadResult(root string) esbuild.OnLoadResult {
+	watchFiles := make([]string, 0, len(cache.fileMtimes))
+	for path := range cache.fileMtimes {
+		watchFiles = append(watchFiles, path)
+	}
+
+	return esbuild.OnLoadResult{
+		Contents:   cache.result,
+		Loader:     esbuild.LoaderJSON,
+		WatchFiles: watchFiles,
+		WatchDirs:  []string{root},
+	}
+}
+
+// Locale caches keyed by the absolute path of their locales directory, as concurrent builds may
+// have different roots.
+var i18nCaches sync.Map
+
+func I18n(config *types.ConfigT) esbuild.Plugin {
+	return esbuild.Plugin{
+		Name: "i18n",
+		Setup: func(build esbuild.PluginBuild) {
+			cwd := build.InitialOptions.AbsWorkingDir
+			root := filepath.Join(cwd, "config", "locales")
+
+			build.OnResolve(esbuild.OnResolveOptions{Filter: `^proscenium/i18n$`},
+				func(args esbuild.OnResolveArgs) (esbuild.OnResolveResult, error) {
+					return esbuild.OnResolveResult{
+						Path:      args.Path,
+						Namespace: "i18n",
 					}, nil
-				}
+				})
 
-				// In non-production, check if locale files have changed via mtimes
-				// before doing any expensive work.
-				if i18nCachedResult != nil {
-					changed := false
+			build.OnLoad(esbuild.OnLoadOptions{Filter: `\.*`, Namespace: "i18n"},
+				func(args esbuild.OnLoadArgs) (esbuild.OnLoadResult, error) {
+					c, _ := i18nCaches.LoadOrStore(root, &i18nCache{})
+					cache := c.(*i18nCache)
 
-					// Check directory mtime for added/removed files.
-					dirInfo, err := os.Stat(root)
-					if err != nil || !dirInfo.ModTime().Equal(i18nDirMtime) {
-						changed = true
+					cache.mutex.Lock()
+					defer cache.mutex.Unlock()
+
+					// In production, return cached result immediately if available.
+					if config.Environment == types.ProdEnv && cache.result != nil {
+						return cache.loadResult(root), nil
 					}
 
-					// Check individual file mtimes for content changes.
-					if !changed {
-						for path, mtime := range i18nFileMtimes {
-							info, err := os.Stat(path)
-							if err != nil || !info.ModTime().Equal(mtime) {
-								changed = true
-								break
+					// In non-production, check if locale files have changed via mtimes
+					// before doing any expensive work.
+					if cache.result != nil {
+						changed := false
+
+						// Check directory mtime for added/removed files.
+						dirInfo, err := os.Stat(root)
+						if err != nil || !dirInfo.ModTime().Equal(cache.dirMtime) {
+							changed = true
+						}
+
+						// Check individual file mtimes for content changes.
+						if !changed {
+							for path, mtime := range cache.fileMtimes {
+								info, err := os.Stat(path)
+								if err != nil || !info.ModTime().Equal(mtime) {
+									changed = true
+									break
+								}
 							}
 						}
-					}
 
-					if !changed {
-						return esbuild.OnLoadResult{
-							Contents: i18nCachedResult,
-							Loader:   esbuild.LoaderJSON,
-						}, nil
+						if !changed {
+							return cache.loadResult(root), nil
+						}
 					}
-				}
-
-				// Record directory mtime.
-				if dirInfo, err := os.Stat(root); err == nil {
-					i18nDirMtime = dirInfo.ModTime()
-				}
-
-				// Read locale files using os.ReadDir instead of filepath.Glob.
-				entries, err := os.ReadDir(root)
-				if err != nil {
-					empty := "{}"
-					i18nCachedResult = &empty
-					return esbuild.OnLoadResult{
-						Contents: i18nCachedResult,
-						Loader:   esbuild.LoaderJSON,
-					}, nil
-				}
 
-				fileMtimes := make(map[string]time.Time, len(entries))
-				contents := map[string]any{}
+					// Record directory mtime.
+					if dirInfo, err := os.Stat(root); err == nil {
+						cache.dirMtime = dirInfo.ModTime()
+					}
 
-				for _, entry := range entries {
-					if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".yml") {
-						continue
+					// Read locale files using os.ReadDir instead of filepath.Glob.
+					entries, err := os.ReadDir(root)
+					if err != nil {
+						empty := "{}"
+						cache.result = &empty
+						cache.fileMtimes = nil
+						return cache.loadResult(root), nil
 					}
 
-					path := filepath.Join(root, entry.Name())
+					fileMtimes := make(map[string]time.Time, len(entries))
+					contents := map[string]any{}
 
-					// Track file mtime for change detection.
-					if info, err := entry.Info(); err == nil {
-						fileMtimes[path] = info.ModTime()
-					}
+					for _, entry := range entries {
+						if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".yml") {
+							continue
+						}
 
-					data, err := os.ReadFile(path)
-					if err != nil {
-						return esbuild.OnLoadResult{}, err
-					}
+						path := filepath.Join(root, entry.Name())
 
-					var yamlData map[string]any
-					if err := yaml.Unmarshal(data, &yamlData); err != nil {
-						return esbuild.OnLoadResult{}, err
-					}
+						// Track file mtime for change detection.
+						if info, err := entry.Info(); err == nil {
+							fileMtimes[path] = info.ModTime()
+						}
+
+						data, err := os.ReadFile(path)
+						if err != nil {
+							return esbuild.OnLoadResult{}, err
+						}
+
+						var yamlData map[string]any
+						if err := yaml.Unmarshal(data, &yamlData); err != nil {
+							return esbuild.OnLoadResult{}, err
+						}
 
-					contents = mergemap.Merge(contents, yamlData)
-				}
+						contents = mergemap.Merge(contents, yamlData)
+					}
 
-				i18nFileMtimes = fileMtimes
+					cache.fileMtimes = fileMtimes
 
-				// Apply camelCase transform directly on the YAML map, then marshal
-				// to JSON once — avoiding the redundant JSON round-trip.
-				transformed := camelCaseKeys(contents)
+					// Apply camelCase transform directly on the YAML map, then marshal
+					// to JSON once — avoiding the redundant JSON round-trip.
+					transformed := camelCaseKeys(contents)
 
-				b, err := json.Marshal(transformed)
-				if err != nil {
-					return esbuild.OnLoadResult{}, err
-				}
+					b, err := json.Marshal(transformed)
+					if err != nil {
+						return esbuild.OnLoadResult{}, err
+					}
 
-				result := string(b)
-				i18nCachedResult = &result
+					result := string(b)
+					cache.result = &result
 
-				return esbuild.OnLoadResult{
-					Contents: i18nCachedResult,
-					Loader:   esbuild.LoaderJSON,
-				}, nil
-			})
-	},
+					return cache.loadResult(root), nil
+				})
+		},
+	}
 }
@@ -0,0 +1,356 @@
+package plugin
+
+import (
+	"encoding/json"
+	"joelmoss/proscenium/internal/types"
+	"joelmoss/proscenium/internal/utils"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	esbuild "github.com/joelmoss/esbuild-internal/api"
+)
+
+// A browser import map. See https://developer.mozilla.org/en-US/docs/Web/HTML/Element/script/type/importmap
+type ImportMapT struct {
+	Imports map[string]string            `json:"imports"`
+	Scopes  map[string]map[string]string `json:"scopes,omitempty"`
+}
+
+// An import map built from the app's package.json, and the stamps of each package.json and
+// node_modules directory that it was built from, keyed by absolute path.
+type builtImportMap struct {
+	importMap *ImportMapT
+	stamps    map[string]fileStamp
+}
+
+// Import maps built from the app's package.json, keyed by the hash of the config.
+var (
+	importMapsMutex sync.Mutex
+	importMaps      = map[string]*builtImportMap{}
+)
+
+// Returns true if the bare specifier of the given resolve `args` may be left intact, and instead
+// mapped by the import map. Import maps only apply to JS imports.
+func isImportMapped(config *types.ConfigT, args esbuild.OnResolveArgs) bool {
+	return config.ImportMap && utils.IsBareModule(args.Path) && !utils.IsUrl(args.Path) &&
+		(args.Kind == esbuild.ResolveJSImportStatement || args.Kind == esbuild.ResolveJSDynamicImport)
+}
+
+// Returns true if the import map maps the bare `specifier` imported by the file at the absolute
+// `importer` path to `urlPath`. Specifiers that it would map elsewhere, such as extensionless
+// subpaths of packages, must be rewritten to their URL path instead.
+func importMapResolves(config *types.ConfigT, specifier string, importer string, urlPath string) bool {
+	mappedPath, ok := cachedImportMap(config).resolve(specifier, packageScope(config, importer))
+	return ok && mappedPath == urlPath
+}
+
+// Returns the URL path that the given bare `specifier` is mapped to when imported from within the
+// given `scope`, the same way that browsers do.
+func (importMap *ImportMapT) resolve(specifier string, scope string) (string, bool) {
+	if imports, ok := importMap.Scopes[scope]; ok {
+		if urlPath, ok := resolveImports(imports, specifier); ok {
+			return urlPath, true
+		}
+	}
+
+	return resolveImports(importMap.Imports, specifier)
+}
+
+func resolveImports(imports map[string]string, specifier string) (string, bool) {
+	if urlPath, ok := imports[specifier]; ok {
+		return urlPath, true
+	}
+
+	prefix := ""
+	for key := range imports {
+		if strings.HasSuffix(key, "/") && strings.HasPrefix(specifier, key) && len(key) > len(prefix) {
+			prefix = key
+		}
+	}
+
+	if prefix == "" {
+		return "", false
+	}
+
+	return imports[prefix] + strings.TrimPrefix(specifier, prefix), true
+}
+
+// Returns the URL path of the package containing the file at the absolute `importer` path, or an
+// empty string if it is not within a package.
+func packageScope(config *types.ConfigT, importer string) string {
+	var urlPath string
+
+	if strings.HasPrefix(importer, types.RubyGemsScope) {
+		// Files loaded from a Ruby gem are imported by their virtual path (ie. "@rubygems/foo/bar.js").
+		urlPath = "/node_modules/" + importer
+	} else if gemUrlPath, ok := utils.RubyGemPathToUrlPath(config, importer); ok {
+		urlPath = gemUrlPath
+	} else if appUrlPath, ok := rootPathToUrlPath(config, importer); ok {
+		urlPath = appUrlPath
+	} else {
+		return ""
+	}
+
+	i := strings.LastIndex(urlPath, "/node_modules/")
+	if i == -1 {
+		return ""
+	}
+
+	prefix := urlPath[:i+len("/node_modules/")]
+	segments := strings.Split(urlPath[len(prefix):], "/")
+
+	name := segments[0]
+	if strings.HasPrefix(name, "@") && len(segments) > 1 {
+		name = path.Join(name, segments[1])
+	}
+
+	return prefix + name + "/"
+}
+
+// Returns the import map of the given `config`, which maps the entry point, each subpath export,
+// and the directory of every dependency in the app's package.json. The dependencies of each package
+// are mapped in the scope of that package, as they may resolve to a different version than when
+// imported by the app. The `@rubygems/*` scopes of each gem, and any aliases to URL paths are also
+// included.
+//
+// The import map depends only on the installed packages, so it is the same in every process, no
+// matter what has been built so far.
+func ImportMap(config *types.ConfigT) ImportMapT {
+	refreshImportMap(config)
+	importMap := cachedImportMap(config)
+
+	result := ImportMapT{Imports: maps.Clone(importMap.Imports), Scopes: map[string]map[string]string{}}
+	for scope, imports := range importMap.Scopes {
+		result.Scopes[scope] = maps.Clone(imports)
+	}
+
+	return result
+}
+
+// Returns the import map of the given `config`, building it on first use. The result is shared, and
+// must not be modified.
+func cachedImportMap(config *types.ConfigT) *ImportMapT {
+	key := config.Hash()
+
+	importMapsMutex.Lock()
+	defer importMapsMutex.Unlock()
+
+	if built, ok := importMaps[key]; ok {
+		return built.importMap
+	}
+
+	importMap, paths := buildImportMap(config)
+	importMaps[key] = &builtImportMap{importMap: importMap, stamps: stampFiles(paths)}
+
+	return importMap
+}
+
+// Forgets the import map of the given `config` if any package.json or node_modules directory that
+// it was built from has changed since, so that it is built again when next used. Checked once at
+// the start of each build, instead of for each import.
+func refreshImportMap(config *types.ConfigT) {
+	key := config.Hash()
+
+	importMapsMutex.Lock()
+	defer importMapsMutex.Unlock()
+
+	if built, ok := importMaps[key]; ok && (built.stamps == nil || stampsChanged(built.stamps)) {
+		delete(importMaps, key)
+	}
+}
+
+// Forgets all built import maps, so they are rebuilt from the installed packages when next used.
+func ResetImportMaps() {
+	importMapsMutex.Lock()
+	defer importMapsMutex.Unlock()
+
+	clear(importMaps)
+}
+
+type packageJson struct {
+	Dependencies map[string]string
+	Exports      json.RawMessage
+}
+
+// Builds the import map of the given `config`, and returns it along with the absolute paths of the
+// package.json files and node_modules directories that it was built from.
+func buildImportMap(config *types.ConfigT) (*ImportMapT, []string) {
+	importMap := &ImportMapT{Imports: map[string]string{}, Scopes: map[string]map[string]string{}}
+	paths := map[string]bool{}
+
+	// Packages are resolved by esbuild, in the same way as the Bundless plugin resolves them. Nothing
+	// is loaded or written.
+	esbuild.Build(esbuild.BuildOptions{
+		Stdin:            &esbuild.StdinOptions{ResolveDir: config.RootPath},
+		AbsWorkingDir:    config.RootPath,
+		LogLevel:         esbuild.LogLevelSilent,
+		Format:           esbuild.FormatESModule,
+		Bundle:           true,
+		Write:            false,
+		PreserveSymlinks: true,
+		Conditions:       []string{config.Environment.String(), "proscenium"},
+		MainFields:       []string{"module", "browser", "main"},
+		Plugins: []esbuild.Plugin{{
+			Name: "importMap",
+			Setup: func(build esbuild.PluginBuild) {
+				build.OnStart(func() (esbuild.OnStartResult, error) {
+					mapDependencies(config, build, importMap, config.RootPath, "", map[string]bool{}, paths)
+					return esbuild.OnStartResult{}, nil
+				})
+			},
+		}},
+	})
+
+	for gemName := range config.RubyGems {
+		importMap.Imports[types.RubyGemsScope+gemName+"/"] = "/node_modules/" + types.RubyGemsScope + gemName + "/"
+	}
+
+	for name, aliasedPath := range config.Aliases {
+		aliasedPath = strings.TrimPrefix(aliasedPath, "unbundle:")
+		if utils.IsBareModule(name) && (path.IsAbs(aliasedPath) || utils.IsUrl(aliasedPath)) {
+			importMap.Imports[name] = aliasedPath
+		}
+	}
+
+	return importMap, slices.Sorted(maps.Keys(paths))
+}
+
+// Maps each dependency in the package.json in the absolute `dir` into the given `scope`, or into
+// the top level imports if the scope is empty. Each dependency is then mapped in its own scope, and
+// `seen` ensures that each is only mapped once. The package.json files and node_modules directories
+// that are read are added to `paths`.
+func mapDependencies(config *types.ConfigT, build esbuild.PluginBuild, importMap *ImportMapT,
+	dir string, scope string, seen map[string]bool, paths map[string]bool) {
+	pkg, ok := readPackageJson(dir)
+	if ok {
+		paths[filepath.Join(dir, "package.json")] = true
+	} else {
+		// The package.json may be added later.
+		paths[dir] = true
+	}
+
+	if !ok || len(pkg.Dependencies) == 0 {
+		return
+	}
+
+	// Dependencies of packages are resolved from their real path, so that symlinked packages (eg.
+	// pnpm) resolve their own dependencies.
+	if scope != "" {
+		if realDir, err := filepath.EvalSymlinks(dir); err == nil {
+			dir = realDir
+		}
+	}
+
+	imports := importMap.Imports
+	if scope != "" {
+		imports = map[string]string{}
+		importMap.Scopes[scope] = imports
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(pkg.Dependencies)) {
+		pkgDir, ok := findPackage(dir, name)
+		if !ok {
+			continue
+		}
+
+		// Packages that are installed, upgraded, or removed change their node_modules directory.
+		paths[strings.TrimSuffix(pkgDir, filepath.FromSlash("/"+name))] = true
+
+		pkgUrlPath, ok := urlPathOf(config, pkgDir)
+		if !ok {
+			continue
+		}
+
+		imports[name+"/"] = pkgUrlPath + "/"
+
+		for _, specifier := range packageSpecifiers(name, pkgDir) {
+			result := build.Resolve(specifier, esbuild.ResolveOptions{
+				ResolveDir: dir,
+				Kind:       esbuild.ResolveJSImportStatement,
+			})
+			if len(result.Errors) > 0 {
+				continue
+			}
+
+			if urlPath, ok := urlPathOf(config, result.Path); ok {
+				imports[specifier] = urlPath
+			}
+		}
+
+		if !seen[pkgUrlPath] {
+			seen[pkgUrlPath] = true
+			mapDependencies(config, build, importMap, pkgDir, pkgUrlPath+"/", seen, paths)
+		}
+	}
+
+	if scope != "" && len(imports) == 0 {
+		delete(importMap.Scopes, scope)
+	}
+}
+
+// Returns the bare specifiers of the entry point, and each subpath export of the package `name` at
+// the absolute `pkgDir`. Subpath patterns cannot be listed, so are left to the directory mapping.
+func packageSpecifiers(name string, pkgDir string) []string {
+	specifiers := []string{name}
+
+	pkg, ok := readPackageJson(pkgDir)
+	if !ok {
+		return specifiers
+	}
+
+	var exports map[string]json.RawMessage
+	if json.Unmarshal(pkg.Exports, &exports) != nil {
+		return specifiers
+	}
+
+	for _, subpath := range slices.Sorted(maps.Keys(exports)) {
+		if strings.HasPrefix(subpath, "./") && !strings.Contains(subpath, "*") &&
+			!strings.HasSuffix(subpath, "/") {
+			specifiers = append(specifiers, name+subpath[1:])
+		}
+	}
+
+	return specifiers
+}
+
+// Finds the package `name` in the node_modules directory of the absolute `dir`, or of any of its
+// parents, the same way as Node.js.
+func findPackage(dir string, name string) (string, bool) {
+	for {
+		pkgDir := filepath.Join(dir, "node_modules", name)
+		if info, err := os.Stat(pkgDir); err == nil && info.IsDir() {
+			return pkgDir, true
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+func readPackageJson(dir string) (packageJson, bool) {
+	var pkg packageJson
+
+	data, err := os.ReadFile(filepath.Join(dir, "package.json"))
+	if err != nil {
+		return pkg, false
+	}
+
+	return pkg, json.Unmarshal(data, &pkg) == nil
+}
+
+// Returns the URL path of the given absolute file system path, if it can be served.
+func urlPathOf(config *types.ConfigT, fsPath string) (string, bool) {
+	if urlPath, ok := utils.RubyGemPathToUrlPath(config, fsPath); ok {
+		return urlPath, true
+	}
+
+	return rootPathToUrlPath(config, fsPath)
+}
@@ -0,0 +1,73 @@
+package plugin
+
+import (
+	"joelmoss/proscenium/internal/debug"
+	"joelmoss/proscenium/internal/types"
+	"joelmoss/proscenium/internal/utils"
+	"os"
+	"path"
+	"path/filepath"
+
+	esbuild "github.com/joelmoss/esbuild-internal/api"
+)
+
+// Images, fonts and SVGs that can be inlined.
+const inlineFilter = `\.(avif|eot|gif|ico|jpe?g|otf|png|svg|ttf|webp|woff2?)$`
+
+// Inlines images, fonts, and SVGs referenced from CSS, or imported from JS, as data URLs, when their
+// size is no more than the `InlineLimit` of the given `config`. Larger files are left to the rest of
+// the plugin chain, which treats them as external, or emits them as files when `BundleAssets` is
+// enabled. Used by both the Bundler and Bundless plugins.
+func inlineAssets(config *types.ConfigT, build esbuild.PluginBuild) {
+	if config.InlineLimit <= 0 {
+		return
+	}
+
+	root := build.InitialOptions.AbsWorkingDir
+
+	build.OnResolve(esbuild.OnResolveOptions{Filter: inlineFilter},
+		func(args esbuild.OnResolveArgs) (esbuild.OnResolveResult, error) {
+			if args.PluginData != nil && args.PluginData.(types.PluginData).IsResolvingPath {
+				return esbuild.OnResolveResult{}, nil
+			}
+
+			// SVGs imported from JS are rendered as components by the Svg plugin.
+			if utils.PathIsSvg(args.Path) && !utils.IsSvgImportedFromCss(args.Path, args) {
+				return esbuild.OnResolveResult{}, nil
+			}
+
+			var absPath string
+			if utils.PathIsRelative(args.Path) {
+				absPath = filepath.Join(args.ResolveDir, args.Path)
+			} else if path.IsAbs(args.Path) {
+				absPath = filepath.Join(root, args.Path)
+			} else {
+				return esbuild.OnResolveResult{}, nil
+			}
+
+			info, err := os.Stat(absPath)
+			if err != nil || info.IsDir() || info.Size() > int64(config.InlineLimit) {
+				return esbuild.OnResolveResult{}, nil
+			}
+
+			debug.Debug("OnResolve(inline)", args.Path, absPath)
+
+			return esbuild.OnResolveResult{Path: absPath, Namespace: "inline"}, nil
+		})
+
+	build.OnLoad(esbuild.OnLoadOptions{Filter: ".*", Namespace: "inline"},
+		func(args esbuild.OnLoadArgs) (esbuild.OnLoadResult, error) {
+			data, err := os.ReadFile(args.Path)
+			if err != nil {
+				return esbuild.OnLoadResult{}, err
+			}
+
+			contents := string(data)
+
+			return esbuild.OnLoadResult{
+				Contents:   &contents,
+				Loader:     esbuild.LoaderDataURL,
+				WatchFiles: []string{args.Path},
+			}, nil
+		})
+}
@@ -0,0 +1,66 @@
+package plugin
+
+import (
+	"fmt"
+	"joelmoss/proscenium/internal/types"
+	"sync"
+
+	esbuild "github.com/joelmoss/esbuild-internal/api"
+)
+
+// Returns a new instance of a registered plugin for a build with the given `config`.
+type Constructor func(config *types.ConfigT) esbuild.Plugin
+
+var (
+	registryMutex sync.RWMutex
+	registry      = map[string]Constructor{}
+)
+
+// Registers a plugin under the given `name`, so that it can be enabled by the `Plugins` config
+// option. Usually called from an `init` function of a package compiled into the library, eg:
+//
+//	func init() {
+//		plugin.Register("graphql", func(config *types.ConfigT) esbuild.Plugin {
+//			return esbuild.Plugin{Name: "graphql", Setup: ...}
+//		})
+//	}
+//
+// Panics if a plugin is already registered with the same `name`.
+func Register(name string, constructor Constructor) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	if _, exists := registry[name]; exists {
+		panic(fmt.Sprintf("plugin %q is already registered", name))
+	}
+
+	registry[name] = constructor
+}
+
+// Removes the plugin registered under the given `name`. Intended for tests only.
+func Unregister(name string) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	delete(registry, name)
+}
+
+// Returns a new instance of each registered plugin enabled by the `Plugins` of the given `config`,
+// in the same order. They run before the built-in plugins, so their resolve and load callbacks take
+// precedence.
+func Registered(config *types.ConfigT) ([]esbuild.Plugin, error) {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+
+	plugins := make([]esbuild.Plugin, 0, len(config.Plugins))
+	for _, name := range config.Plugins {
+		constructor, ok := registry[name]
+		if !ok {
+			return nil, fmt.Errorf("No plugin is registered with the name %q", name)
+		}
+
+		plugins = append(plugins, constructor(config))
+	}
+
+	return plugins, nil
+}
@@ -7,6 +7,7 @@ import (
 	"errors"
 	"joelmoss/proscenium/internal/types"
 	"strings"
+	"sync"
 
 	esbuild "github.com/joelmoss/esbuild-internal/api"
 )
@@ -14,20 +15,30 @@ import (
 //go:embed src
 var efs embed.FS
 
-var npmReplacements = map[string][]byte{}
+var (
+	npmReplacements      = map[string][]byte{}
+	npmReplacementsMutex sync.RWMutex
+)
 
-func Get(specifier string) ([]byte, bool) {
+// Returns the npm replacement for the given `specifier` in the given `env`. Server-side rendering
+// builds prefer the node replacement, while all others prefer the browser replacement.
+func Get(specifier string, env types.Environment, ssr bool) ([]byte, bool) {
 	var replacement []byte
 	var ok bool
 
-	if types.Config.Environment == types.DevEnv {
-		replacement, ok = get(specifier + "_browser_dev")
+	platform := "_browser"
+	if ssr {
+		platform = "_node"
+	}
+
+	if env == types.DevEnv {
+		replacement, ok = get(specifier + platform + "_dev")
 		if !ok {
 			replacement, ok = get(specifier + "_dev")
 		}
 	}
 	if !ok {
-		replacement, ok = get(specifier + "_browser")
+		replacement, ok = get(specifier + platform)
 	}
 	if !ok {
 		replacement, ok = get(specifier)
@@ -38,12 +49,18 @@ func Get(specifier string) ([]byte, bool) {
 
 // Get returns the npm replacement by the given name.
 func get(name string) ([]byte, bool) {
+	npmReplacementsMutex.RLock()
+	defer npmReplacementsMutex.RUnlock()
+
 	ret, ok := npmReplacements[name]
 	return ret, ok
 }
 
 // Build builds the npm replacements.
 func Build() (n int, err error) {
+	npmReplacementsMutex.Lock()
+	defer npmReplacementsMutex.Unlock()
+
 	if len(npmReplacements) > 0 {
 		return len(npmReplacements), nil
 	}
@@ -12,8 +12,8 @@ import (
 	esbuild "github.com/joelmoss/esbuild-internal/api"
 )
 
-// Resolve the given `filePath` relative to the root, where the filePath is a URL path or bare
-// specifier.
+// Resolve the given `filePath` relative to the root of the given `config`, where the filePath is a
+// URL path or bare specifier.
 //
 // This function is primarily intended to be used to resolve bare or NPM modules outside
 // of any build. It is used to resolve paths that are not part of the build process. It does not
@@ -24,44 +24,44 @@ import (
 //
 // Returns an URL path (has a leading slash and can be appended to the app domain), and the absolute
 // file system path.
-func Resolve(filePath string, importer string) (urlPath string, absPath string, err error) {
-	rootPath := types.Config.RootPath
+func Resolve(config *types.ConfigT, filePath string, importer string) (urlPath string, absPath string, err error) {
+	rootPath := config.RootPath
 
 	debug.Debug("Resolve:begin", map[string]string{"filePath": filePath, "importer": importer})
 
 	if utils.IsUrl(filePath) {
-		return returnResolve(filePath, nil)
+		return returnResolve(config, filePath, nil)
 	}
 
 	if utils.PathIsRelative(filePath) {
 		if importer == "" {
-			return returnResolve("", errors.New("relative paths are not supported when an importer is not given"))
+			return returnResolve(config, "", errors.New("relative paths are not supported when an importer is not given"))
 		}
 
 		filePath = path.Join(path.Dir(importer), filePath)
 
 		// TODO: while filePath is relative, the importer could be a ruby gem. Check now, and return
 		// correct path (beginning /node_modules/@rubygems/...)
-		gemName, gemPath, found := utils.PathIsRubyGem(filePath)
+		gemName, gemPath, found := utils.PathIsRubyGem(config, filePath)
 		if found {
-			return returnResolve("/node_modules/"+types.RubyGemsScope+gemName+strings.TrimPrefix(filePath, gemPath), nil)
+			return returnResolve(config, "/node_modules/"+types.RubyGemsScope+gemName+strings.TrimPrefix(filePath, gemPath), nil)
 		}
 
-		return returnResolve(strings.TrimPrefix(filePath, rootPath), nil)
+		return returnResolve(config, strings.TrimPrefix(filePath, rootPath), nil)
 	}
 
 	gemName := ""
 	if utils.IsRubyGem(filePath) {
 		var err error
-		gemName, rootPath, err = utils.ResolveRubyGem(filePath)
+		gemName, rootPath, err = utils.ResolveRubyGem(config, filePath)
 		if err != nil {
-			return returnResolve(filePath, err)
+			return returnResolve(config, filePath, err)
 		}
 
 		pathSuffix := utils.RemoveRubygemPrefix(filePath, gemName)
 
 		if _, ok := utils.HasExtension(filePath); ok {
-			return returnResolve("/node_modules/"+filePath, nil)
+			return returnResolve(config, "/node_modules/"+filePath, nil)
 		}
 
 		if pathSuffix == "" {
@@ -73,7 +73,7 @@ func Resolve(filePath string, importer string) (urlPath string, absPath string,
 
 	if !utils.IsBareModule(filePath) {
 		if _, ok := utils.HasExtension(filePath); ok {
-			return returnResolve(filePath, nil)
+			return returnResolve(config, filePath, nil)
 		}
 	}
 
@@ -83,7 +83,7 @@ func Resolve(filePath string, importer string) (urlPath string, absPath string,
 	}
 
 	logLevel := esbuild.LogLevelWarning
-	if types.Config.Debug {
+	if config.Debug {
 		logLevel = esbuild.LogLevelDebug
 	}
 
@@ -91,7 +91,7 @@ func Resolve(filePath string, importer string) (urlPath string, absPath string,
 		EntryPoints:      []string{filePath},
 		AbsWorkingDir:    rootPath,
 		Format:           esbuild.FormatESModule,
-		Conditions:       []string{types.Config.Environment.String(), "proscenium"},
+		Conditions:       []string{config.Environment.String(), "proscenium"},
 		Write:            false,
 		Metafile:         true,
 		LogLevel:         logLevel,
@@ -105,13 +105,13 @@ func Resolve(filePath string, importer string) (urlPath string, absPath string,
 	})
 
 	if len(result.Errors) > 0 {
-		return returnResolve("", errors.New(result.Errors[0].Text))
+		return returnResolve(config, "", errors.New(result.Errors[0].Text))
 	}
 
 	var metadata struct{ Inputs map[string]any }
 	jsonErr := json.Unmarshal([]byte(result.Metafile), &metadata)
 	if jsonErr != nil {
-		return returnResolve("", jsonErr)
+		return returnResolve(config, "", jsonErr)
 	}
 
 	for key := range metadata.Inputs {
@@ -120,13 +120,13 @@ func Resolve(filePath string, importer string) (urlPath string, absPath string,
 	}
 
 	if gemName != "" {
-		return returnResolve("/node_modules/"+types.RubyGemsScope+gemName+"/"+filePath, nil)
+		return returnResolve(config, "/node_modules/"+types.RubyGemsScope+gemName+"/"+filePath, nil)
 	}
 
-	return returnResolve("/"+filePath, nil)
+	return returnResolve(config, "/"+filePath, nil)
 }
 
-func returnResolve(filePath string, err error) (string, string, error) {
+func returnResolve(config *types.ConfigT, filePath string, err error) (string, string, error) {
 	absPath := filePath
 	errStr := ""
 	if err != nil {
@@ -143,7 +143,7 @@ func returnResolve(filePath string, err error) (string, string, error) {
 	isRubyGem := false
 	relativePath := strings.TrimPrefix(filePath, "/node_modules/")
 	if utils.IsRubyGem(relativePath) {
-		gemName, gemPath, err := utils.ResolveRubyGem(relativePath)
+		gemName, gemPath, err := utils.ResolveRubyGem(config, relativePath)
 		if err != nil {
 			return "", "", err
 		}
@@ -154,7 +154,7 @@ func returnResolve(filePath string, err error) (string, string, error) {
 	}
 
 	if !isRubyGem {
-		absPath = path.Join(types.Config.RootPath, absPath)
+		absPath = path.Join(config.RootPath, absPath)
 	}
 
 	return filePath, absPath, err
@@ -1,6 +1,12 @@
 package types
 
-import "encoding/json"
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+)
 
 var Debug = false
 
@@ -29,9 +35,26 @@ func (e Environment) String() string {
 // - External - Map of external paths - passed directly to esbuild's `external` option.
 // - Precompile - Map of glob patterns to precompile.
 // - External - List of paths or glob patterns to treat as external.
+// - Loaders - Map of file extensions (eg. ".txt") to the esbuild loader (eg. "text") they are loaded with.
+// - BundleAssets? - Emit images and fonts as files with hashed names, instead of treating them as external.
+// - InlineLimit - Maximum size in bytes of images, fonts and SVGs referenced from CSS or imported from JS that are inlined as data URLs.
+// - CssModuleExports? - Export the class names of CSS modules imported from JS as named and default exports, instead of a Proxy.
+// - Plugins - Names of registered plugins to enable, in the order they run, before the built-in plugins.
 // - CodeSplitting?
 // - Bundle?
 // - Debug?
+// - ImportMap? - When unbundling, leave bare specifiers intact, and map them with an import map.
+// - Incremental? - Reuse esbuild contexts between builds of the same entry point.
+// - IncrementalLimit - Maximum number of esbuild contexts kept alive when incremental, and of ETags kept for `CheckFresh` and builds whose file hashes are kept (default: 100).
+// - Ssr? - Build for server-side rendering by a JS runtime, instead of for the browser.
+// - LiveReload? - Record the inputs of each build, so that changes to them can be reported.
+// - ShardCompile? - Partition the precompile globs by directory or gem, and build each concurrently.
+// - CompileConcurrency - Maximum number of groups built at once when sharding (default: number of CPUs).
+// - RetainManifests - Number of previous compiles whose outputs are kept, instead of deleting the output dir before each compile.
+// - Targets - ES version or minimum engine versions to target, but not browserslist queries (default: ES2022).
+// - EnvironmentTargets - Map of environment names to the targets of that environment, which override `Targets`.
+// - LegacyTargets - Targets of a second compile to the "legacy" output dir, for older browsers.
+// - IntegrityAlgorithm - Hash algorithm of Subresource Integrity strings: sha256, sha384 (default) or sha512.
 type ConfigT struct {
 	RootPath      string
 	OutputDir     string
@@ -41,16 +64,36 @@ type ConfigT struct {
 	Aliases       map[string]string
 	External      []string
 	Precompile    []string
+	Plugins       []string
+	Loaders       map[string]string
+	BundleAssets  bool
+	InlineLimit   int
 	Debug         bool
 	CodeSplitting bool
 	Bundle        bool
 	Environment   Environment
+	Incremental   bool
+	LiveReload    bool
+	ImportMap     bool
+	Ssr           bool
+
+	Targets            []string
+	EnvironmentTargets map[string][]string
+	LegacyTargets      []string
+	IntegrityAlgorithm string
+	RetainManifests    int
+	ShardCompile       bool
+	CompileConcurrency int
+	CssModuleExports   bool
+	IncrementalLimit   int
 
 	// For testing
 	InternalTesting      bool
 	UseDevCSSModuleNames bool
 }
 
+// Global config, only used for debugging and by tests. Builds, resolvers and plugins are always
+// given their config explicitly.
 var Config = ConfigT{CodeSplitting: true, Bundle: true}
 var zeroConfig = &ConfigT{
 	CodeSplitting: true,
@@ -61,6 +104,17 @@ func (config *ConfigT) Reset() {
 	*config = *zeroConfig
 }
 
+// Returns a hash of the config, which changes whenever any of its values change.
+func (config *ConfigT) Hash() string {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return ""
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
 type PluginData = struct {
 	IsResolvingPath bool
 	ImportedFromJs  bool
@@ -68,8 +122,37 @@ type PluginData = struct {
 	GemPath         string
 }
 
-func UnmarshalConfig(data []byte) error {
-	return json.Unmarshal(data, &Config)
+// Returns a new config with default values.
+func NewConfig() *ConfigT {
+	config := *zeroConfig
+	return &config
+}
+
+// Hash algorithms supported by `IntegrityAlgorithm`.
+var IntegrityAlgorithms = []string{"sha256", "sha384", "sha512"}
+
+// Parses the given JSON `data` into a new config.
+func ParseConfig(data []byte) (*ConfigT, error) {
+	config := NewConfig()
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, err
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// Returns an error if any of the values of the config are invalid.
+func (config *ConfigT) Validate() error {
+	if config.IntegrityAlgorithm != "" && !slices.Contains(IntegrityAlgorithms, config.IntegrityAlgorithm) {
+		return fmt.Errorf("unsupported IntegrityAlgorithm %q, expected one of %v", config.IntegrityAlgorithm,
+			IntegrityAlgorithms)
+	}
+
+	return nil
 }
 
 // The maximum size of an HTTP response body to cache.
@@ -0,0 +1,96 @@
+package utils
+
+import (
+	"fmt"
+	"joelmoss/proscenium/internal/types"
+	"maps"
+	"path"
+	"strings"
+
+	esbuild "github.com/joelmoss/esbuild-internal/api"
+)
+
+// Loaders that can be assigned to an extension by the `Loaders` config option. CSS loaders are not
+// included, as stylesheets are always loaded by the Css plugin.
+var loaderNames = map[string]esbuild.Loader{
+	"base64":  esbuild.LoaderBase64,
+	"binary":  esbuild.LoaderBinary,
+	"copy":    esbuild.LoaderCopy,
+	"dataurl": esbuild.LoaderDataURL,
+	"empty":   esbuild.LoaderEmpty,
+	"file":    esbuild.LoaderFile,
+	"js":      esbuild.LoaderJS,
+	"json":    esbuild.LoaderJSON,
+	"jsx":     esbuild.LoaderJSX,
+	"text":    esbuild.LoaderText,
+	"ts":      esbuild.LoaderTS,
+	"tsx":     esbuild.LoaderTSX,
+}
+
+// Extensions of the images and fonts that are emitted as hashed files when `BundleAssets` is enabled.
+var assetExtensions = []string{
+	".avif", ".eot", ".gif", ".ico", ".jpeg", ".jpg", ".otf", ".png", ".ttf", ".webp", ".woff", ".woff2",
+}
+
+// Returns the `Loaders` of the given `config`, along with the `file` loader for images and fonts
+// when `BundleAssets` is enabled. Configured loaders take precedence.
+func loaders(config *types.ConfigT) map[string]string {
+	if !config.BundleAssets {
+		return config.Loaders
+	}
+
+	result := make(map[string]string, len(assetExtensions)+len(config.Loaders))
+	for _, ext := range assetExtensions {
+		result[ext] = "file"
+	}
+	maps.Copy(result, config.Loaders)
+
+	return result
+}
+
+// Sets the loader of each extension in the `Loaders` of the given `config` on the given build
+// `options`. When `BundleAssets` is enabled, images and fonts are emitted as hashed files, which
+// are referenced by their URL path within the output dir.
+func ApplyLoaders(config *types.ConfigT, options *esbuild.BuildOptions) error {
+	loaders := loaders(config)
+	if len(loaders) == 0 {
+		return nil
+	}
+
+	if config.BundleAssets {
+		options.PublicPath = "/" + strings.TrimPrefix(config.OutputDir, "public/")
+	}
+
+	options.Loader = make(map[string]esbuild.Loader, len(loaders))
+
+	for ext, name := range loaders {
+		if !strings.HasPrefix(ext, ".") || len(ext) < 2 {
+			return fmt.Errorf("Loader extensions must begin with a dot, but found %q", ext)
+		}
+
+		if ext == ".css" {
+			return fmt.Errorf("The loader of %q cannot be changed", ext)
+		}
+
+		loader, ok := loaderNames[name]
+		if !ok {
+			return fmt.Errorf("Unsupported loader %q for %q", name, ext)
+		}
+
+		options.Loader[ext] = loader
+	}
+
+	return nil
+}
+
+// Returns true if the extension of the given `filePath` has a loader in the `Loaders` of the given
+// `config`. Such files are always bundled, instead of being treated as external assets.
+func HasLoader(config *types.ConfigT, filePath string) bool {
+	ext := path.Ext(filePath)
+	if ext == "" {
+		return false
+	}
+
+	_, ok := loaders(config)[ext]
+	return ok
+}
@@ -0,0 +1,156 @@
+package utils
+
+import (
+	"fmt"
+	"joelmoss/proscenium/internal/types"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	esbuild "github.com/joelmoss/esbuild-internal/api"
+)
+
+var esTargets = map[string]esbuild.Target{
+	"es5":    esbuild.ES5,
+	"es2015": esbuild.ES2015,
+	"es2016": esbuild.ES2016,
+	"es2017": esbuild.ES2017,
+	"es2018": esbuild.ES2018,
+	"es2019": esbuild.ES2019,
+	"es2020": esbuild.ES2020,
+	"es2021": esbuild.ES2021,
+	"es2022": esbuild.ES2022,
+	"es2023": esbuild.ES2023,
+	"es2024": esbuild.ES2024,
+	"esnext": esbuild.ESNext,
+}
+
+// Engine names, including the browserslist names of mobile browsers.
+var engineNames = map[string]esbuild.EngineName{
+	"chrome":  esbuild.EngineChrome,
+	"and_chr": esbuild.EngineChrome,
+	"deno":    esbuild.EngineDeno,
+	"edge":    esbuild.EngineEdge,
+	"firefox": esbuild.EngineFirefox,
+	"and_ff":  esbuild.EngineFirefox,
+	"ie":      esbuild.EngineIE,
+	"ios":     esbuild.EngineIOS,
+	"ios_saf": esbuild.EngineIOS,
+	"node":    esbuild.EngineNode,
+	"opera":   esbuild.EngineOpera,
+	"safari":  esbuild.EngineSafari,
+}
+
+// Matches "chrome100", "chrome 100" and "chrome >= 100".
+var targetRegex = regexp.MustCompile(`^([a-z_]+?)\s*(?:>=\s*)?(\d+(?:\.\d+){0,2})$`)
+
+// Sets the target and engines of the given build `options` from the `Targets` of the given
+// `config`, or the `EnvironmentTargets` of its environment. Without any targets, builds target
+// ES2022. CSS nesting is transformed unless browser engines are targeted, as an ES version alone
+// says nothing about CSS support.
+//
+// Server-side rendering builds are not run by a browser, and so always target ES2022.
+func ApplyTargets(config *types.ConfigT, options *esbuild.BuildOptions) error {
+	queries := config.Targets
+	if envQueries, ok := config.EnvironmentTargets[config.Environment.String()]; ok {
+		queries = envQueries
+	}
+
+	if len(queries) == 0 || config.Ssr {
+		options.Target = esbuild.ES2022
+		options.Supported = map[string]bool{
+			// Ensure CSS nesting is transformed for browsers that don't support it.
+			"nesting": false,
+		}
+		return nil
+	}
+
+	target, engines, err := ParseTargets(queries)
+	if err != nil {
+		return err
+	}
+
+	options.Target = target
+	options.Engines = engines
+
+	if len(engines) == 0 {
+		options.Supported = map[string]bool{"nesting": false}
+	}
+
+	return nil
+}
+
+// Parses the given `queries` into an esbuild target and engines. Each query is either an ES version
+// (eg. "es2020"), or an engine and its minimum version (eg. "chrome100", "safari 15.4" or
+// "ios_saf >= 15"). Browserslist queries (eg. "defaults" or "> 0.5%") are not supported, as they
+// depend on browser usage data. When an engine is given more than once, its lowest version is used.
+func ParseTargets(queries []string) (esbuild.Target, []esbuild.Engine, error) {
+	target := esbuild.DefaultTarget
+	versions := map[esbuild.EngineName]string{}
+
+	for _, query := range queries {
+		query = strings.ToLower(strings.TrimSpace(query))
+
+		if esTarget, ok := esTargets[query]; ok {
+			if target != esbuild.DefaultTarget && target != esTarget {
+				return target, nil, fmt.Errorf("Only one ES version can be targeted, but found %q", query)
+			}
+			target = esTarget
+			continue
+		}
+
+		matches := targetRegex.FindStringSubmatch(query)
+		if matches == nil {
+			return target, nil, fmt.Errorf(
+				"Unsupported target %q; browserslist queries are not supported, so target an ES version (eg. es2020), or an engine and its minimum version (eg. chrome100 or safari >= 15)",
+				query,
+			)
+		}
+
+		name, ok := engineNames[matches[1]]
+		if !ok {
+			return target, nil, fmt.Errorf("Unsupported target engine %q", matches[1])
+		}
+
+		if version, exists := versions[name]; !exists || compareVersions(matches[2], version) < 0 {
+			versions[name] = matches[2]
+		}
+	}
+
+	engines := make([]esbuild.Engine, 0, len(versions))
+	for name, version := range versions {
+		engines = append(engines, esbuild.Engine{Name: name, Version: version})
+	}
+	slices.SortFunc(engines, func(a, b esbuild.Engine) int {
+		return int(a.Name) - int(b.Name)
+	})
+
+	return target, engines, nil
+}
+
+// Compares the dot separated versions `a` and `b`, returning -1 if `a` is lower, 1 if it is higher,
+// or 0 if they are equal.
+func compareVersions(a string, b string) int {
+	aParts := strings.Split(a, ".")
+	bParts := strings.Split(b, ".")
+
+	for i := range max(len(aParts), len(bParts)) {
+		var aPart, bPart int
+		if i < len(aParts) {
+			aPart, _ = strconv.Atoi(aParts[i])
+		}
+		if i < len(bParts) {
+			bPart, _ = strconv.Atoi(bParts[i])
+		}
+
+		if aPart != bPart {
+			if aPart < bPart {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	return 0
+}
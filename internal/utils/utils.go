@@ -101,9 +101,9 @@ func RemoveRubygemPrefix(path string, gemName string) string {
 	return strings.TrimPrefix(path, types.RubyGemsScope+gemName)
 }
 
-func HasAlias(path string) (string, bool) {
-	if len(types.Config.Aliases) > 0 {
-		if aliasedPath, exists := types.Config.Aliases[path]; exists {
+func HasAlias(config *types.ConfigT, path string) (string, bool) {
+	if len(config.Aliases) > 0 {
+		if aliasedPath, exists := config.Aliases[path]; exists {
 			return aliasedPath, true
 		}
 	}
@@ -159,8 +159,8 @@ func extractScopedPackageName(path string) string {
 	return rest[:secondSlash]
 }
 
-func PathIsRubyGem(path string) (gemName string, gemPath string, found bool) {
-	for gemName, gemPath := range types.Config.RubyGems {
+func PathIsRubyGem(config *types.ConfigT, path string) (gemName string, gemPath string, found bool) {
+	for gemName, gemPath := range config.RubyGems {
 		if strings.HasPrefix(path, gemPath) {
 			return gemName, gemPath, true
 		}
@@ -185,10 +185,10 @@ func IsRubyGem(path string, mustBeFromNodeModules ...bool) bool {
 	return strings.HasPrefix(path, types.RubyGemsScope) || strings.HasPrefix(path, "node_modules/"+types.RubyGemsScope)
 }
 
-func ResolveRubyGem(path string) (gemName string, gemPath string, err error) {
+func ResolveRubyGem(config *types.ConfigT, path string) (gemName string, gemPath string, err error) {
 	name := extractScopedPackageName(path)
 
-	if gemPath, exists := types.Config.RubyGems[name]; exists {
+	if gemPath, exists := config.RubyGems[name]; exists {
 		return name, gemPath, nil
 	} else {
 		return "", "", fmt.Errorf("Could not resolve Ruby gem %q. Is %q in your Gemfile?", name, name)
@@ -200,8 +200,8 @@ func ResolveRubyGem(path string) (gemName string, gemPath string, err error) {
 // Example:
 //
 //	"/full/path/to/rubygems/@rubygems/foo/bar" -> "/node_modules/@rubygems/foo/bar"
-func RubyGemPathToUrlPath(fsPath string) (urlPath string, found bool) {
-	if gemName, gemPath, ok := PathIsRubyGem(fsPath); ok {
+func RubyGemPathToUrlPath(config *types.ConfigT, fsPath string) (urlPath string, found bool) {
+	if gemName, gemPath, ok := PathIsRubyGem(config, fsPath); ok {
 		suffix := strings.TrimPrefix(fsPath, gemPath)
 		return path.Join("/node_modules", types.RubyGemsScope, gemName, suffix), true
 	}
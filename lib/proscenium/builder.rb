@@ -9,7 +9,9 @@ module Proscenium
     class Result < FFI::Struct
       layout :success, :bool,
              :response, :string,
-             :content_hash, :string
+             :content_hash, :string,
+             :integrity, :string,
+             :etag, :string
     end
 
     class ResolveResult < FFI::Struct
@@ -40,11 +42,45 @@ module Proscenium
         :pointer # Config as JSON.
       ], ResolveResult.by_value
 
+      attach_function :check_fresh, [
+        :string, # Path or entry point.
+        :string, # ETag.
+        :pointer # Config as JSON.
+      ], :bool
+
       attach_function :compile, [
         :pointer # Config as JSON.
       ], CompileResult.by_value
 
+      attach_function :dependency_graph, [
+        :string, # Path or entry point.
+        :pointer # Config as JSON.
+      ], CompileResult.by_value
+
+      attach_function :import_map, [
+        :pointer # Config as JSON.
+      ], CompileResult.by_value
+
       attach_function :reset_config, [], :void
+
+      attach_function :changed_assets, [], CompileResult.by_value
+
+      attach_function :start_live_reload, [
+        :string # Address to listen on.
+      ], CompileResult.by_value
+
+      # Each result's strings are allocated by Go, and must be freed once they have been read.
+      attach_function :free_result, [Result.by_value], :void
+      attach_function :free_resolve_result, [ResolveResult.by_value], :void
+      attach_function :free_compile_result, [CompileResult.by_value], :void
+
+      # Copies the values of the given FFI `result` struct into a Hash, and then releases the memory
+      # allocated for it by calling the given `free_function`.
+      def self.read_and_free(result, free_function)
+        result.members.to_h { |member| [member, result[member]] }
+      ensure
+        public_send(free_function, result)
+      end
     end
 
     class BuildError < Error
@@ -73,24 +109,75 @@ module Proscenium
       end
     end
 
-    def self.build_to_string(path, root: nil)
-      new(root:).build_to_string(path)
+    # Pass `ssr: true` to build a bundle for server-side rendering by a JS runtime, instead of for
+    # the browser.
+    def self.build_to_string(path, root: nil, ssr: false)
+      new(root:, ssr:).build_to_string(path)
     end
 
     def self.resolve(path, root: nil)
       new(root:).resolve(path)
     end
 
+    def self.check_fresh(path, etag, root: nil)
+      new(root:).check_fresh(path, etag)
+    end
+
+    def self.dependency_graph(path, root: nil)
+      new(root:).dependency_graph(path)
+    end
+
     def self.compile(root: nil)
       new(root:).compile
     end
 
+    def self.import_map(root: nil)
+      new(root:).import_map
+    end
+
+    # Returns the URL paths of each asset that has changed since it was last built. Requires the
+    # `live_reload` config option.
+    def self.changed_assets
+      result = Request.read_and_free(Request.changed_assets, :free_compile_result)
+      result[:success] ? JSON.parse(result[:messages]) : []
+    end
+
+    # Returns the URL of the live reload server of the current process, starting it on first use, or
+    # nil if live reload is disabled. The server only sees the assets built by its own process, so
+    # it is started lazily, after any fork, so that each Puma worker runs its own. Workers that
+    # cannot listen on `live_reload_address`, as another worker already is, listen on a random port.
+    def self.live_reload_url
+      return unless Proscenium.config.live_reload
+      return @live_reload_url if @live_reload_pid == Process.pid
+
+      address = Proscenium.config.live_reload_address
+      address = begin
+        start_live_reload(address)
+      rescue Error
+        start_live_reload("#{address.rpartition(':').first}:0")
+      end
+
+      @live_reload_pid = Process.pid
+      @live_reload_url = "http://#{address}"
+    end
+
+    # Starts a server on the given `address` that streams server-sent events for each asset that
+    # changes, and returns the address it is listening on.
+    def self.start_live_reload(address)
+      result = Request.read_and_free(Request.start_live_reload(address), :free_compile_result)
+      unless result[:success]
+        raise Error, "Failed to start live reload server - #{result[:messages]}"
+      end
+
+      result[:messages]
+    end
+
     # Intended for tests only.
     def self.reset_config!
       Request.reset_config
     end
 
-    def initialize(root: nil)
+    def initialize(root: nil, ssr: false)
       @request_config = FFI::MemoryPointer.from_string({
         RootPath: (root || Rails.root).to_s,
         OutputDir: "public#{Proscenium.config.output_dir}",
@@ -103,13 +190,30 @@ module Proscenium
         Aliases: Proscenium.config.aliases,
         External: Proscenium.config.external,
         Precompile: Proscenium.config.precompile,
+        Plugins: Proscenium.config.plugins,
+        Loaders: Proscenium.config.loaders,
+        BundleAssets: Proscenium.config.bundle_assets,
+        InlineLimit: Proscenium.config.inline_limit,
+        CssModuleExports: Proscenium.config.css_module_exports,
+        ImportMap: Proscenium.config.import_map,
+        Ssr: ssr,
+        Incremental: Proscenium.config.incremental,
+        IncrementalLimit: Proscenium.config.incremental_limit,
+        LiveReload: Proscenium.config.live_reload,
+        Targets: Proscenium.config.targets,
+        EnvironmentTargets: Proscenium.config.environment_targets,
+        LegacyTargets: Proscenium.config.legacy_targets,
+        IntegrityAlgorithm: Proscenium.config.integrity_algorithm,
+        RetainManifests: Proscenium.config.retain_manifests,
+        ShardCompile: Proscenium.config.shard_compile,
+        CompileConcurrency: Proscenium.config.compile_concurrency,
         Debug: Proscenium.config.debug
       }.to_json)
     end
 
     def build_to_string(path)
       ActiveSupport::Notifications.instrument('build.proscenium', identifier: path) do
-        result = Request.build_to_string(path, @request_config)
+        result = Request.read_and_free(Request.build_to_string(path, @request_config), :free_result)
 
         raise BuildError.new(path, result[:response]) unless result[:success]
 
@@ -117,9 +221,15 @@ module Proscenium
       end
     end
 
+    # Returns true if the given `etag` is that of the last build of `path`, and none of its inputs
+    # have changed since. Nothing is built.
+    def check_fresh(path, etag)
+      Request.check_fresh(path, etag, @request_config)
+    end
+
     def resolve(path)
       ActiveSupport::Notifications.instrument('resolve.proscenium', identifier: path) do
-        result = Request.resolve(path, @request_config)
+        result = Request.read_and_free(Request.resolve(path, @request_config), :free_resolve_result)
 
         raise ResolveError.new(path, result[:url_path]) unless result[:success]
 
@@ -127,8 +237,27 @@ module Proscenium
       end
     end
 
+    # Returns the dependency graph of the given `path`, as a Hash of URL paths with the keys `file`,
+    # `imports`, `dynamicImports` and `css`. Suitable for rendering `<link rel="modulepreload">`.
+    def dependency_graph(path)
+      result = Request.read_and_free(Request.dependency_graph(path, @request_config),
+                                     :free_compile_result)
+      raise Error, "Failed to build #{path} - #{result[:messages]}" unless result[:success]
+
+      JSON.parse(result[:messages])
+    end
+
+    # Returns the import map of the dependencies in package.json, as a JSON string.
+    # Requires the `import_map` config option, and `bundle` to be false.
+    def import_map
+      result = Request.read_and_free(Request.import_map(@request_config), :free_compile_result)
+      raise Error, "Failed to build import map - #{result[:messages]}" unless result[:success]
+
+      result[:messages]
+    end
+
     def compile
-      result = Request.compile(@request_config)
+      result = Request.read_and_free(Request.compile(@request_config), :free_compile_result)
       result[:success]
     end
 
@@ -44,5 +44,38 @@ module Proscenium
     def include_javascripts
       SideLoad::JS_COMMENT.html_safe
     end
+
+    # Renders the import map of the dependencies in package.json, which maps the bare specifiers
+    # left intact by unbundled builds. Must be included before any module scripts.
+    #
+    # @return [String] the HTML script tag, or nil if import maps are disabled.
+    def include_import_map
+      return if Proscenium.config.bundle || !Proscenium.config.import_map
+
+      tag.script Builder.import_map.html_safe, type: 'importmap',
+                                               nonce: content_security_policy_nonce
+    end
+
+    # Connects to the live reload server when `config.proscenium.live_reload` is enabled. Changed
+    # stylesheets are swapped in place, and any other change reloads the page.
+    #
+    # @return [String] the HTML script tag, or nil if live reload is disabled.
+    def include_live_reload
+      return unless (url = Builder.live_reload_url)
+
+      javascript_tag <<~JS, nonce: true
+        new EventSource(#{url.to_json}).addEventListener('change', (event) => {
+          const { path, type } = JSON.parse(event.data);
+          const links = type === 'css' ? [...document.querySelectorAll('link[rel="stylesheet"]')]
+            .filter((link) => new URL(link.href).pathname === path) : [];
+          if (links.length === 0) return location.reload();
+          for (const link of links) {
+            const url = new URL(link.href);
+            url.searchParams.set('t', Date.now());
+            link.href = url.toString();
+          }
+        });
+      JS
+    end
   end
 end
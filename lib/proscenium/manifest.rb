@@ -3,6 +3,10 @@
 module Proscenium
   module Manifest
     mattr_accessor :manifest, default: {}
+    mattr_accessor :entries, default: {}
+    mattr_accessor :files, default: {}
+    mattr_accessor :legacy_manifest, default: {}
+    mattr_accessor :legacy_entries, default: {}
     mattr_accessor :loaded, default: false
 
     module_function
@@ -11,43 +15,71 @@ module Proscenium
       loaded
     end
 
+    # Loads the manifest written by the compiler, which maps the logical path of each entry point
+    # (eg. "/app/views/users/index.js" or "@rubygems/gem_name/lib/foo.js") to its hashed output.
     def load!
-      public_path = Rails.configuration.paths['public'].first
-      self.manifest = {}
-      self.loaded = false
+      reset!
 
       if Proscenium.config.manifest_path.exist?
         self.loaded = true
 
-        JSON.parse(Proscenium.config.manifest_path.read)['outputs'].each do |outpath, details|
-          next if !details.key?('entryPoint')
-
-          outpath = outpath.delete_prefix "#{public_path}/"
-
-          ep = details['entryPoint']
-          ep = if (gem = BundledGems.paths.find { |_, v| ep.start_with? "#{v}/" })
-                 "@rubygems/#{gem[0]}#{ep.delete_prefix(gem[1])}"
-               else
-                 ep.delete_prefix(Rails.root.to_s)
-               end
+        data = JSON.parse(Proscenium.config.manifest_path.read)
+        self.entries = data['entries']
+        self.files = data['files']
 
-          manifest[ep] = [
-            "/#{outpath}",
-            details['cssBundle']&.delete_prefix(public_path)
-          ].compact
+        entries.each do |path, entry|
+          manifest[path] = [entry['file'], *entry['css']]
         end
+
+        load_legacy! data['legacy']
       end
 
       manifest
     end
 
+    # Loads the legacy section of the manifest, which is only present when
+    # `config.proscenium.legacy_targets` is set. Its files are merged into `files`.
+    def load_legacy!(data)
+      return unless data
+
+      self.legacy_entries = data['entries']
+      files.merge!(data['files'])
+
+      legacy_entries.each do |path, entry|
+        legacy_manifest[path] = [entry['file'], *entry['css']]
+      end
+    end
+
     def reset!
       self.manifest = {}
+      self.entries = {}
+      self.files = {}
+      self.legacy_manifest = {}
+      self.legacy_entries = {}
       self.loaded = false
     end
 
+    # @return [Array<String>, nil] the URL paths of the output and stylesheets of the given entry
+    #   point.
     def [](key)
       loaded? ? manifest[key] : nil
     end
+
+    # @return [Array<String>, nil] the URL paths of the legacy output and stylesheets of the given
+    #   entry point, or nil if legacy assets were not compiled.
+    def legacy(key)
+      loaded? ? legacy_manifest[key] : nil
+    end
+
+    # @return [Hash, nil] the manifest entry of the given entry point, including the URL paths of
+    #   the chunks it imports (`imports`) and its stylesheets (`css`).
+    def entry(key)
+      loaded? ? entries[key] : nil
+    end
+
+    # @return [Hash, nil] the `integrity` and `size` of the output at the given URL path.
+    def file(url_path)
+      loaded? ? files[url_path] : nil
+    end
   end
 end
@@ -72,7 +72,8 @@ module Proscenium
         response['X-Proscenium-Middleware'] = name
         response.set_header 'SourceMap', "#{@request.path_info}.map"
         response.content_type = content_type
-        response.etag = result[:content_hash]
+        response.etag = result[:etag].presence || result[:content_hash]
+        response['X-Proscenium-Integrity'] = result[:integrity] if result[:integrity].present?
 
         if @request.fresh?(response)
           response.status = 304
@@ -84,6 +85,14 @@ module Proscenium
         response.finish
       end
 
+      def render_not_modified(etag)
+        response = Rack::Response.new
+        response['X-Proscenium-Middleware'] = name
+        response.etag = etag
+        response.status = 304
+        response.finish
+      end
+
       def name
         @name ||= self.class.name.split('::').last.downcase
       end
@@ -4,8 +4,20 @@ module Proscenium
   class Middleware
     class Esbuild < Base
       def attempt
+        if (etag = fresh_etag)
+          return render_not_modified(etag)
+        end
+
         render_response Builder.build_to_string(path_to_build)
       end
+
+      private
+
+      # Returns the ETag sent by the client if it is that of the last build of the requested path,
+      # and none of its inputs have changed since, which is checked without building.
+      def fresh_etag
+        @request.if_none_match_etags.find { |etag| Builder.check_fresh(path_to_build, etag) }
+      end
     end
   end
 end
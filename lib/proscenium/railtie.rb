@@ -18,8 +18,72 @@ module Proscenium
     config.proscenium.aliases = {}
     config.proscenium.external = Set['*.rjs', '*.gif', '*.jpg', '*.png', '*.woff2', '*.woff']
     config.proscenium.precompile = Set.new
+
+    # Number of previous pre-compiles whose assets are kept alongside the new ones, so that clients
+    # holding old HTML can still load them during a zero-downtime deploy. When zero, the output
+    # directory is deleted before each pre-compile.
+    config.proscenium.retain_manifests = 0
+
+    # Partition the pre-compile globs into groups by directory or gem, and build each group
+    # concurrently, at most `compile_concurrency` at a time (defaults to the number of CPUs).
+    config.proscenium.shard_compile = false
+    config.proscenium.compile_concurrency = 0
     config.proscenium.output_dir = '/assets'
 
+    # Map of file extensions to the esbuild loader they are bundled with, eg.
+    # `{ '.txt' => 'text', '.wasm' => 'binary' }`. Supports `text`, `dataurl`, `file`, `binary`,
+    # `base64`, `copy`, `empty`, `js`, `jsx`, `ts`, `tsx` and `json`.
+    config.proscenium.loaders = {}
+
+    # Emit images and fonts imported from CSS and JS as files with content hashed names in the
+    # output directory, and rewrite references to them, instead of treating them as external.
+    config.proscenium.bundle_assets = false
+
+    # Images, fonts and SVGs referenced from CSS or imported from JS that are no larger than this
+    # many bytes are inlined as data URLs. Zero disables inlining.
+    config.proscenium.inline_limit = 0
+
+    # Export the class names of CSS modules imported from JS as named exports and a plain default
+    # export, instead of a Proxy that returns a class name for any property.
+    config.proscenium.css_module_exports = false
+
+    # Names of esbuild plugins registered in Go with `plugin.Register`, in the order they should
+    # run. They run before the built-in plugins.
+    config.proscenium.plugins = []
+
+    # Browsers to target, as an ES version or the minimum version of each engine (eg. `chrome100`,
+    # `safari >= 15` or `es2020`). Browserslist queries such as `defaults` are not supported.
+    # Applies to both JS and CSS, and defaults to ES2022. Targets of a particular environment can be
+    # given in `environment_targets`, eg. `{ production: %w[chrome90 safari15] }`.
+    config.proscenium.targets = []
+    config.proscenium.environment_targets = {}
+
+    # When set, pre-compiles a second copy of all assets to `<output_dir>/legacy` for these targets
+    # (eg. `%w[es2017]`), which is listed in the `legacy` section of the manifest.
+    config.proscenium.legacy_targets = []
+
+    # When `bundle` is false, leave bare specifiers intact instead of rewriting them to URL paths,
+    # and map them with an import map, which is rendered by the `include_import_map` helper.
+    config.proscenium.import_map = false
+
+    # Reuse esbuild contexts between builds of the same entry point, so that unchanged files are not
+    # parsed again. Files are only rebuilt when they, or any of their dependencies, have changed.
+    config.proscenium.incremental = false
+
+    # Maximum number of entry points whose esbuild contexts are kept alive when `incremental` is
+    # enabled, and of paths whose ETags are kept for `check_fresh`. The least recently used are
+    # disposed of first.
+    config.proscenium.incremental_limit = 100
+
+    # Start a server that streams an event whenever an asset built in development changes, so that
+    # the `include_live_reload` helper can hot-swap stylesheets and reload the page for javascripts.
+    config.proscenium.live_reload = false
+    config.proscenium.live_reload_address = '127.0.0.1:35729'
+
+    # Hash algorithm of the Subresource Integrity strings returned with each build, and written to
+    # the manifest for each compiled asset: 'sha256', 'sha384' or 'sha512'.
+    config.proscenium.integrity_algorithm = 'sha384'
+
     # List of environment variable names that should be passed to the builder, which will then be
     # passed to esbuild's `Define` option. Being explicit about which environment variables are
     # defined means a faster build, as esbuild will have less to do.
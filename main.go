@@ -1,11 +1,19 @@
 package main
 
 /*
+#include <stdlib.h>
+
+// Every `char*` field in the result structs below is allocated by Go with `malloc`, and is owned by
+// the caller. Once its values have been read, release each result with its matching `free_*`
+// function, which frees every field.
+
 struct Result {
 	int success;
 	char* response;
 	char* contentHash;
-	};
+	char* integrity;
+	char* etag;
+};
 struct ResolveResult {
 	int success;
 	char* urlPath;
@@ -15,37 +23,137 @@ struct CompileResult {
 	int success;
 	char* messages;
 };
+struct ContextResult {
+	int success;
+	int id;
+	char* error;
+};
 */
 import "C"
 
 import (
+	"encoding/json"
+	"fmt"
 	"joelmoss/proscenium/internal/builder"
+	"joelmoss/proscenium/internal/debug"
+	"joelmoss/proscenium/internal/plugin"
 	"joelmoss/proscenium/internal/resolver"
 	"joelmoss/proscenium/internal/types"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
 )
 
-// Cache the last config JSON to skip unmarshalling when unchanged.
-var lastConfigJSON string
+// Configs parsed from the JSON given to `build_to_string`, `resolve` and `compile`, keyed by that
+// JSON, so that unchanged configs are not unmarshalled again. Only the most recently parsed
+// `configCacheLimit` configs are kept, and `configCacheKeys` holds their keys, oldest first.
+const configCacheLimit = 16
 
-func unmarshalConfigIfChanged(configJson *C.char) error {
+var (
+	configCache      = map[string]*types.ConfigT{}
+	configCacheKeys  []string
+	configCacheMutex sync.Mutex
+)
+
+func configFromJson(configJson *C.char) (*types.ConfigT, error) {
 	json := C.GoString(configJson)
-	if json == lastConfigJSON {
-		return nil
+
+	configCacheMutex.Lock()
+	defer configCacheMutex.Unlock()
+
+	if config, ok := configCache[json]; ok {
+		return config, nil
 	}
 
-	err := types.UnmarshalConfig([]byte(json))
+	config, err := parseConfig(json)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	if len(configCacheKeys) == configCacheLimit {
+		delete(configCache, configCacheKeys[0])
+		configCacheKeys = configCacheKeys[1:]
+	}
+
+	configCache[json] = config
+	configCacheKeys = append(configCacheKeys, json)
+
+	return config, nil
+}
+
+// Parses the given config JSON, and enables debug output if the config asks for it, as debug
+// output is not tied to any one build.
+func parseConfig(json string) (*types.ConfigT, error) {
+	config, err := types.ParseConfig([]byte(json))
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Debug {
+		debug.Enable()
+	}
+
+	return config, nil
+}
+
+// Configs created with `create_context`, keyed by their ID.
+var (
+	contexts      sync.Map
+	lastContextId atomic.Int32
+)
+
+func configFromContext(id C.int) (*types.ConfigT, error) {
+	config, ok := contexts.Load(int32(id))
+	if !ok {
+		return nil, fmt.Errorf("Unknown context %d", id)
 	}
 
-	lastConfigJSON = json
-	return nil
+	return config.(*types.ConfigT), nil
 }
 
 //export reset_config
 func reset_config() {
 	types.Config.Reset()
-	lastConfigJSON = ""
+
+	configCacheMutex.Lock()
+	clear(configCache)
+	configCacheKeys = nil
+	configCacheMutex.Unlock()
+
+	debug.Disable()
+
+	builder.DisposeIncremental()
+	builder.ResetLiveReload()
+	builder.ResetFreshness()
+	plugin.ResetImportMaps()
+}
+
+// Create a context for the given `config`, and return its ID. The ID can then be passed to the
+// `*_ctx` functions, which are safe to call concurrently, even with contexts of different configs.
+//
+// - config
+//
+//export create_context
+func create_context(configJson *C.char) C.struct_ContextResult {
+	config, err := parseConfig(C.GoString(configJson))
+	if err != nil {
+		return C.struct_ContextResult{C.int(0), C.int(0), C.CString(err.Error())}
+	}
+
+	id := lastContextId.Add(1)
+	contexts.Store(id, config)
+
+	return C.struct_ContextResult{C.int(1), C.int(id), C.CString("")}
+}
+
+// Dispose of the context with the given `id`.
+//
+//export dispose_context
+func dispose_context(id C.int) {
+	contexts.Delete(int32(id))
 }
 
 // Build the given `path` using the `config`.
@@ -55,18 +163,80 @@ func reset_config() {
 //
 //export build_to_string
 func build_to_string(filePath *C.char, configJson *C.char) C.struct_Result {
-	err := unmarshalConfigIfChanged(configJson)
+	config, err := configFromJson(configJson)
+	if err != nil {
+		return C.struct_Result{C.int(0), C.CString(err.Error()), C.CString(""), C.CString(""), C.CString("")}
+	}
+
+	return buildToString(config, filePath)
+}
+
+// Build the given `path` using the config of the context with the given `id`.
+//
+// - id - The context ID returned by `create_context`.
+// - path - The path to build relative to `root`.
+//
+//export build_to_string_ctx
+func build_to_string_ctx(id C.int, filePath *C.char) C.struct_Result {
+	config, err := configFromContext(id)
 	if err != nil {
-		return C.struct_Result{C.int(0), C.CString(err.Error()), C.CString("")}
+		return C.struct_Result{C.int(0), C.CString(err.Error()), C.CString(""), C.CString(""), C.CString("")}
 	}
 
-	success, result, contentHash := builder.BuildToString(C.GoString(filePath))
+	return buildToString(config, filePath)
+}
+
+func buildToString(config *types.ConfigT, filePath *C.char) C.struct_Result {
+	success, result, contentHash, etag := builder.BuildToStringWithETag(config, C.GoString(filePath))
 
 	if success {
-		return C.struct_Result{C.int(1), C.CString(result), C.CString(contentHash)}
+		integrity := builder.Integrity(config, []byte(result))
+		return C.struct_Result{C.int(1), C.CString(result), C.CString(contentHash), C.CString(integrity), C.CString(etag)}
+	}
+
+	return C.struct_Result{C.int(0), C.CString(result), C.CString(""), C.CString(""), C.CString("")}
+}
+
+// Returns true if the given `etag` is that of the last build of `path` using the `config`, and none
+// of its inputs have changed since. Nothing is built.
+//
+// - path - The path to build relative to `root`.
+// - etag - The ETag returned by `build_to_string`.
+// - config
+//
+//export check_fresh
+func check_fresh(filePath *C.char, etag *C.char, configJson *C.char) C.int {
+	config, err := configFromJson(configJson)
+	if err != nil {
+		return C.int(0)
+	}
+
+	return checkFresh(config, filePath, etag)
+}
+
+// Returns true if the given `etag` is that of the last build of `path` using the config of the
+// context with the given `id`, and none of its inputs have changed since.
+//
+// - id - The context ID returned by `create_context`.
+// - path - The path to build relative to `root`.
+// - etag - The ETag returned by `build_to_string_ctx`.
+//
+//export check_fresh_ctx
+func check_fresh_ctx(id C.int, filePath *C.char, etag *C.char) C.int {
+	config, err := configFromContext(id)
+	if err != nil {
+		return C.int(0)
 	}
 
-	return C.struct_Result{C.int(0), C.CString(result), C.CString("")}
+	return checkFresh(config, filePath, etag)
+}
+
+func checkFresh(config *types.ConfigT, filePath *C.char, etag *C.char) C.int {
+	if builder.CheckFresh(config, C.GoString(filePath), C.GoString(etag)) {
+		return C.int(1)
+	}
+
+	return C.int(0)
 }
 
 // Resolve the given `path` relative to the `root`.
@@ -76,12 +246,31 @@ func build_to_string(filePath *C.char, configJson *C.char) C.struct_Result {
 //
 //export resolve
 func resolve(filePath *C.char, configJson *C.char) C.struct_ResolveResult {
-	err := unmarshalConfigIfChanged(configJson)
+	config, err := configFromJson(configJson)
 	if err != nil {
 		return C.struct_ResolveResult{C.int(0), C.CString(err.Error()), C.CString("")}
 	}
 
-	urlPath, absPath, err := resolver.Resolve(C.GoString(filePath), "")
+	return resolvePath(config, filePath)
+}
+
+// Resolve the given `path` relative to the `root` of the context with the given `id`.
+//
+// - id - The context ID returned by `create_context`.
+// - path - The path to build relative to `root`.
+//
+//export resolve_ctx
+func resolve_ctx(id C.int, filePath *C.char) C.struct_ResolveResult {
+	config, err := configFromContext(id)
+	if err != nil {
+		return C.struct_ResolveResult{C.int(0), C.CString(err.Error()), C.CString("")}
+	}
+
+	return resolvePath(config, filePath)
+}
+
+func resolvePath(config *types.ConfigT, filePath *C.char) C.struct_ResolveResult {
+	urlPath, absPath, err := resolver.Resolve(config, C.GoString(filePath), "")
 	if err != nil {
 		return C.struct_ResolveResult{C.int(0), C.CString(string(err.Error())), C.CString("")}
 	}
@@ -95,12 +284,30 @@ func resolve(filePath *C.char, configJson *C.char) C.struct_ResolveResult {
 //
 //export compile
 func compile(configJson *C.char) C.struct_CompileResult {
-	err := unmarshalConfigIfChanged(configJson)
+	config, err := configFromJson(configJson)
 	if err != nil {
-		return C.struct_CompileResult{C.int(0), C.CString("")}
+		return C.struct_CompileResult{C.int(0), C.CString(err.Error())}
 	}
 
-	success, messages := builder.Compile()
+	return compileAssets(config)
+}
+
+// Compile assets using the config of the context with the given `id`.
+//
+// - id - The context ID returned by `create_context`.
+//
+//export compile_ctx
+func compile_ctx(id C.int) C.struct_CompileResult {
+	config, err := configFromContext(id)
+	if err != nil {
+		return C.struct_CompileResult{C.int(0), C.CString(err.Error())}
+	}
+
+	return compileAssets(config)
+}
+
+func compileAssets(config *types.ConfigT) C.struct_CompileResult {
+	success, messages := builder.Compile(config)
 
 	if success {
 		return C.struct_CompileResult{C.int(1), C.CString(messages)}
@@ -109,4 +316,167 @@ func compile(configJson *C.char) C.struct_CompileResult {
 	return C.struct_CompileResult{C.int(0), C.CString(messages)}
 }
 
+// Return the dependency graph of the given `path` using the `config`, as JSON in the `messages` of
+// the result. The graph includes the URL paths of the static imports, dynamic imports and CSS of the
+// entry point.
+//
+// - path - The path to build relative to `root`.
+// - config
+//
+//export dependency_graph
+func dependency_graph(filePath *C.char, configJson *C.char) C.struct_CompileResult {
+	config, err := configFromJson(configJson)
+	if err != nil {
+		return C.struct_CompileResult{C.int(0), C.CString(err.Error())}
+	}
+
+	return dependencyGraph(config, filePath)
+}
+
+// Return the dependency graph of the given `path` using the config of the context with the given
+// `id`.
+//
+// - id - The context ID returned by `create_context`.
+// - path - The path to build relative to `root`.
+//
+//export dependency_graph_ctx
+func dependency_graph_ctx(id C.int, filePath *C.char) C.struct_CompileResult {
+	config, err := configFromContext(id)
+	if err != nil {
+		return C.struct_CompileResult{C.int(0), C.CString(err.Error())}
+	}
+
+	return dependencyGraph(config, filePath)
+}
+
+func dependencyGraph(config *types.ConfigT, filePath *C.char) C.struct_CompileResult {
+	graph, err := builder.DependencyGraph(config, C.GoString(filePath))
+	if err != nil {
+		return C.struct_CompileResult{C.int(0), C.CString(err.Error())}
+	}
+
+	j, err := json.Marshal(graph)
+	if err != nil {
+		return C.struct_CompileResult{C.int(0), C.CString(err.Error())}
+	}
+
+	return C.struct_CompileResult{C.int(1), C.CString(string(j))}
+}
+
+// Return the import map of all bare specifiers imported by unbundled builds using the `config`, as
+// JSON in the `messages` of the result.
+//
+// - config
+//
+//export import_map
+func import_map(configJson *C.char) C.struct_CompileResult {
+	config, err := configFromJson(configJson)
+	if err != nil {
+		return C.struct_CompileResult{C.int(0), C.CString(err.Error())}
+	}
+
+	return importMap(config)
+}
+
+// Return the import map of all bare specifiers imported by unbundled builds using the config of the
+// context with the given `id`.
+//
+// - id - The context ID returned by `create_context`.
+//
+//export import_map_ctx
+func import_map_ctx(id C.int) C.struct_CompileResult {
+	config, err := configFromContext(id)
+	if err != nil {
+		return C.struct_CompileResult{C.int(0), C.CString(err.Error())}
+	}
+
+	return importMap(config)
+}
+
+func importMap(config *types.ConfigT) C.struct_CompileResult {
+	result, err := builder.ImportMap(config)
+	if err != nil {
+		return C.struct_CompileResult{C.int(0), C.CString(err.Error())}
+	}
+
+	return C.struct_CompileResult{C.int(1), C.CString(result)}
+}
+
+// Return the URL paths of each asset that has changed since it was last built, as a JSON array in
+// the `messages` of the result. Requires the `LiveReload` config option.
+//
+//export changed_assets
+func changed_assets() C.struct_CompileResult {
+	data, err := json.Marshal(builder.ChangedAssets())
+	if err != nil {
+		return C.struct_CompileResult{C.int(0), C.CString(err.Error())}
+	}
+
+	return C.struct_CompileResult{C.int(1), C.CString(string(data))}
+}
+
+// The address of the live reload server, once started.
+var (
+	liveReloadAddr  string
+	liveReloadMutex sync.Mutex
+)
+
+// Start an HTTP server on the given `address`, which streams server-sent events for each asset that
+// changes. Returns the address that the server is listening on in the `messages` of the result, or
+// the error. Calling again returns the address of the running server.
+//
+// - address - The address to listen on, such as "127.0.0.1:0".
+//
+//export start_live_reload
+func start_live_reload(address *C.char) C.struct_CompileResult {
+	liveReloadMutex.Lock()
+	defer liveReloadMutex.Unlock()
+
+	if liveReloadAddr != "" {
+		return C.struct_CompileResult{C.int(1), C.CString(liveReloadAddr)}
+	}
+
+	listener, err := net.Listen("tcp", C.GoString(address))
+	if err != nil {
+		return C.struct_CompileResult{C.int(0), C.CString(err.Error())}
+	}
+
+	liveReloadAddr = listener.Addr().String()
+	go http.Serve(listener, builder.LiveReloadHandler(250*time.Millisecond))
+
+	return C.struct_CompileResult{C.int(1), C.CString(liveReloadAddr)}
+}
+
+// Free the strings allocated for the given build `result`.
+//
+//export free_result
+func free_result(result C.struct_Result) {
+	C.free(unsafe.Pointer(result.response))
+	C.free(unsafe.Pointer(result.contentHash))
+	C.free(unsafe.Pointer(result.integrity))
+	C.free(unsafe.Pointer(result.etag))
+}
+
+// Free the strings allocated for the given resolve `result`.
+//
+//export free_resolve_result
+func free_resolve_result(result C.struct_ResolveResult) {
+	C.free(unsafe.Pointer(result.urlPath))
+	C.free(unsafe.Pointer(result.absPath))
+}
+
+// Free the strings allocated for the given compile `result`.
+//
+//export free_compile_result
+func free_compile_result(result C.struct_CompileResult) {
+	C.free(unsafe.Pointer(result.messages))
+}
+
+// Free the strings allocated for the given context `result`.
+//
+//export free_context_result
+func free_context_result(result C.struct_ContextResult) {
+	C.free(unsafe.Pointer(result.error))
+}
+
 func main() {}
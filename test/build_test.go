@@ -1,13 +1,15 @@
 package proscenium_test
 
 import (
+	"joelmoss/proscenium/internal/types"
+
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 )
 
-var assertCommonBuildBehaviour = func(build func(string) (bool, string, string)) {
+var assertCommonBuildBehaviour = func(build func(*types.ConfigT, string) (bool, string, string)) {
 	It("fails on unknown entrypoint", func() {
-		success, result, _ := build("unknown.js")
+		success, result, _ := build(&types.Config, "unknown.js")
 
 		Expect(success).To(BeFalse())
 		Expect(result).To(Equal("{\"ID\":\"\",\"PluginName\":\"\",\"Text\":\"Could not resolve \\\"unknown.js\\\"\",\"Location\":null,\"Notes\":null,\"Detail\":null}"))
@@ -15,7 +17,7 @@ var assertCommonBuildBehaviour = func(build func(string) (bool, string, string))
 
 	It("fails when entrypoint is not a bare specifier", func() {
 		for _, entryPoint := range [3]string{"/unknown.js", "./unknown.js", "../unknown.js"} {
-			success, result, _ := build(entryPoint)
+			success, result, _ := build(&types.Config, entryPoint)
 
 			Expect(success).To(BeFalse())
 			Expect(result).To(Equal("{\"ID\":\"\",\"PluginName\":\"\",\"Text\":\"Could not resolve \\\"" + entryPoint + "\\\"\",\"Location\":null,\"Notes\":null,\"Detail\":\"Entrypoints must be bare specifiers\"}"))
@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
 )
 
 // Describe("nested", func() {
@@ -405,6 +406,20 @@ var _ = Describe("BuildToString", func() {
 	})
 })
 
+var _ = Describe("Integrity", func() {
+	code := []byte(`console.log("hello");`)
+
+	It("defaults to sha384", func() {
+		Expect(b.Integrity(&types.Config, code)).To(Equal("sha384-ym/3cF/gAcW1/eerNQGFaOSOuU2LHI6RYvChaVur/G+PkVozZ5Zo8Uu5R2S2zm7C"))
+	})
+
+	It("uses the configured algorithm", func() {
+		types.Config.IntegrityAlgorithm = "sha256"
+
+		Expect(b.Integrity(&types.Config, code)).To(Equal("sha256-N4H5TqgSuzNDfekEngS8OvQaDnOXFksFc3nAjDsKxIk="))
+	})
+})
+
 func BenchmarkBuildToString(bm *testing.B) {
 	_, filename, _, _ := runtime.Caller(0)
 	types.Config.RootPath = path.Join(path.Dir(filename), "..", "fixtures", "dummy")
@@ -413,7 +428,7 @@ func BenchmarkBuildToString(bm *testing.B) {
 	types.Config.InternalTesting = true
 
 	for bm.Loop() {
-		success, result, _ := b.BuildToString("lib/foo.js")
+		success, result, _ := b.BuildToString(&types.Config, "lib/foo.js")
 
 		if !success {
 			panic("Build failed: " + result)
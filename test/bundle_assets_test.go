@@ -0,0 +1,142 @@
+package proscenium_test
+
+import (
+	"encoding/json"
+	b "joelmoss/proscenium/internal/builder"
+	"joelmoss/proscenium/internal/types"
+	"os"
+	"path"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("BundleAssets", func() {
+	BeforeEach(func() {
+		types.Config.BundleAssets = true
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(path.Join(types.Config.RootPath, types.Config.OutputDir, "lib", "assets"))
+	})
+
+	It("rewrites CSS url() references to hashed files", func() {
+		_, code, _ := b.BuildToString(&types.Config, "lib/assets/index.css")
+
+		Expect(code).To(MatchRegexp(`url\(/assets/lib/assets/logo-\$[A-Z0-9]+\$\.png\)`))
+
+		matches, _ := filepath.Glob(path.Join(types.Config.RootPath, types.Config.OutputDir, "lib/assets/logo-*.png"))
+		Expect(matches).To(HaveLen(1))
+	})
+
+	It("leaves references to Rails' public directory intact", func() {
+		_, code, _ := b.BuildToString(&types.Config, "lib/assets/index.css")
+
+		Expect(code).To(ContainSubstring(`url(/images/public.png)`))
+	})
+
+	It("imports hashed files from JS as their URL", func() {
+		_, code, _ := b.BuildToString(&types.Config, "lib/assets/index.js")
+
+		Expect(code).To(MatchRegexp(`"/assets/lib/assets/logo-\$[A-Z0-9]+\$\.png"`))
+	})
+
+	It("rewrites CSS url() references to hashed fonts", func() {
+		success, code, _ := b.BuildToString(&types.Config, "lib/assets/fonts.css")
+
+		Expect(success).To(BeTrue(), code)
+		Expect(code).To(MatchRegexp(`url\(/assets/lib/assets/body-\$[A-Z0-9]+\$\.woff2\)`))
+		Expect(code).To(MatchRegexp(`url\(/assets/lib/assets/logo-\$[A-Z0-9]+\$\.png\)`))
+	})
+
+	It("writes the hashed files of CSS modules imported from JS", func() {
+		success, code, _ := b.BuildToString(&types.Config, "lib/assets/module.js")
+
+		Expect(success).To(BeTrue(), code)
+		Expect(code).To(MatchRegexp(`url\(/assets/lib/assets/logo-\$[A-Z0-9]+\$\.png\)`))
+
+		matches, _ := filepath.Glob(path.Join(types.Config.RootPath, types.Config.OutputDir, "lib/assets/logo-*.png"))
+		Expect(matches).To(HaveLen(1))
+	})
+
+	It("does not write the hashed files of CSS modules when rendering on the server", func() {
+		types.Config.Ssr = true
+		types.Config.CssModuleExports = true
+
+		success, code, _ := b.BuildToString(&types.Config, "lib/assets/module.js")
+
+		Expect(success).To(BeTrue(), code)
+
+		matches, _ := filepath.Glob(path.Join(types.Config.RootPath, types.Config.OutputDir, "lib/assets/logo-*.png"))
+		Expect(matches).To(BeEmpty())
+	})
+
+	It("retains the hashed files of CSS modules imported from JS when compiled", func() {
+		types.Config.Precompile = []string{"./lib/assets/module.js"}
+		types.Config.RetainManifests = 1
+		DeferCleanup(func() {
+			os.RemoveAll(path.Join(types.Config.RootPath, types.Config.OutputDir))
+		})
+
+		success, result := b.Compile(&types.Config)
+		Expect(success).To(BeTrue(), result)
+
+		data, err := os.ReadFile(path.Join(types.Config.RootPath, types.Config.OutputDir, ".manifest.json"))
+		Expect(err).NotTo(HaveOccurred())
+
+		var manifest b.Manifest
+		Expect(json.Unmarshal(data, &manifest)).To(Succeed())
+
+		matches, _ := filepath.Glob(path.Join(types.Config.RootPath, types.Config.OutputDir, "lib/assets/logo-*.png"))
+		Expect(matches).To(HaveLen(1))
+
+		urlPath := "/assets/lib/assets/" + filepath.Base(matches[0])
+		Expect(manifest.Files).To(HaveKey(urlPath))
+		Expect(manifest.Files[urlPath].Integrity).To(HavePrefix("sha384-"))
+		Expect(manifest.Files[urlPath].Size).To(BeNumerically(">", 0))
+	})
+})
+
+var _ = Describe("InlineLimit", func() {
+	AfterEach(func() {
+		os.RemoveAll(path.Join(types.Config.RootPath, types.Config.OutputDir, "lib", "assets"))
+	})
+
+	It("inlines files within the limit as data URLs", func() {
+		types.Config.InlineLimit = 1024
+
+		_, code, _ := b.BuildToString(&types.Config, "lib/assets/inline.css")
+
+		Expect(code).To(ContainSubstring(`url(data:image/png;base64,`))
+		Expect(code).To(ContainSubstring(`url("data:image/svg+xml,`))
+	})
+
+	It("inlines files imported from JS as data URLs", func() {
+		types.Config.InlineLimit = 1024
+
+		_, code, _ := b.BuildToString(&types.Config, "lib/assets/index.js")
+
+		Expect(code).To(ContainSubstring(`"data:image/png;base64,`))
+	})
+
+	It("inlines files imported from JS as data URLs when unbundled", func() {
+		types.Config.InlineLimit = 1024
+		types.Config.Bundle = false
+
+		_, code, _ := b.BuildToString(&types.Config, "lib/assets/index.js")
+
+		Expect(code).To(ContainSubstring(`"data:image/png;base64,`))
+		Expect(code).NotTo(ContainSubstring(`import logo from "/lib/assets/logo.png"`))
+	})
+
+	It("emits files over the limit", func() {
+		types.Config.InlineLimit = 10
+		types.Config.BundleAssets = true
+
+		_, code, _ := b.BuildToString(&types.Config, "lib/assets/inline.css")
+
+		Expect(code).To(MatchRegexp(`url\(/assets/lib/assets/logo-\$[A-Z0-9]+\$\.png\)`))
+		Expect(code).NotTo(ContainSubstring(`data:`))
+	})
+})
@@ -0,0 +1,268 @@
+package proscenium_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"joelmoss/proscenium/internal/cli"
+	"joelmoss/proscenium/internal/types"
+	"os"
+	"path"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("cli.Run", func() {
+	var stdout, stderr *gbytes.Buffer
+
+	run := func(args ...string) int {
+		return cli.Run(context.Background(), args, strings.NewReader(""), stdout, stderr)
+	}
+
+	BeforeEach(func() {
+		stdout = gbytes.NewBuffer()
+		stderr = gbytes.NewBuffer()
+	})
+
+	It("prints usage without a command", func() {
+		Expect(run()).To(Equal(2))
+		Expect(stderr).To(gbytes.Say(`Usage: proscenium <command> \[flags\]`))
+	})
+
+	It("prints usage for help", func() {
+		Expect(run("help")).To(Equal(0))
+		Expect(stdout).To(gbytes.Say(`Usage: proscenium <command> \[flags\]`))
+	})
+
+	It("fails with an unknown command", func() {
+		Expect(run("unknown")).To(Equal(2))
+		Expect(stderr).To(gbytes.Say(`Unknown command "unknown"`))
+	})
+
+	It("fails with an unknown flag", func() {
+		Expect(run("build", "lib/foo.js", "-unknown")).To(Equal(2))
+		Expect(stderr).To(gbytes.Say(`flag provided but not defined: -unknown`))
+	})
+
+	It("requires a specifier to build", func() {
+		Expect(run("build", "-root", types.Config.RootPath)).To(Equal(2))
+		Expect(stderr).To(gbytes.Say(`The build command requires a specifier`))
+	})
+
+	It("fails with an unknown environment", func() {
+		Expect(run("build", "lib/foo.js", "-env", "staging")).To(Equal(1))
+		Expect(stderr).To(gbytes.Say(`error: Invalid config - unknown environment "staging"`))
+	})
+
+	Describe("config", func() {
+		It("is read from stdin", func() {
+			config := `{"RootPath": "` + types.Config.RootPath + `"}`
+			code := cli.Run(context.Background(), []string{"resolve", "lib/foo.js", "-config", "-"},
+				strings.NewReader(config), stdout, stderr)
+
+			Expect(code).To(Equal(0), string(stderr.Contents()))
+			Expect(stdout).To(gbytes.Say(`/lib/foo.js\n`))
+		})
+
+		It("is read from a file", func() {
+			configPath := path.Join(GinkgoT().TempDir(), "config.json")
+			config := `{"RootPath": "` + types.Config.RootPath + `"}`
+			Expect(os.WriteFile(configPath, []byte(config), 0644)).To(Succeed())
+
+			Expect(run("resolve", "lib/foo.js", "-config", configPath)).To(Equal(0))
+			Expect(stdout).To(gbytes.Say(`/lib/foo.js\n`))
+		})
+
+		It("is read from PROSCENIUM_CONFIG", func() {
+			GinkgoT().Setenv("PROSCENIUM_CONFIG", `{"RootPath": "`+types.Config.RootPath+`"}`)
+
+			Expect(run("resolve", "lib/foo.js")).To(Equal(0))
+			Expect(stdout).To(gbytes.Say(`/lib/foo.js\n`))
+		})
+
+		It("fails when invalid", func() {
+			code := cli.Run(context.Background(), []string{"resolve", "lib/foo.js", "-config", "-"},
+				strings.NewReader(`{`), stdout, stderr)
+
+			Expect(code).To(Equal(1))
+			Expect(stderr).To(gbytes.Say(`error: Invalid config - unexpected end of JSON input`))
+		})
+
+		It("is overridden by flags", func() {
+			code := cli.Run(context.Background(),
+				[]string{"resolve", "lib/foo.js", "-config", "-", "-root", types.Config.RootPath},
+				strings.NewReader(`{"RootPath": "/unknown"}`), stdout, stderr)
+
+			Expect(code).To(Equal(0), string(stderr.Contents()))
+			Expect(stdout).To(gbytes.Say(`/lib/foo.js\n`))
+		})
+	})
+
+	Describe("build", func() {
+		It("prints the output", func() {
+			Expect(run("build", "lib/foo.js", "-root", types.Config.RootPath)).To(Equal(0))
+			Expect(stdout).To(gbytes.Say(`console.log\("/lib/foo.js"\);`))
+		})
+
+		It("accepts flags before the specifier", func() {
+			Expect(run("build", "-root", types.Config.RootPath, "lib/foo.js")).To(Equal(0))
+			Expect(stdout).To(gbytes.Say(`console.log\("/lib/foo.js"\);`))
+		})
+
+		It("prints the output as JSON", func() {
+			Expect(run("build", "lib/foo.js", "-root", types.Config.RootPath, "-json")).To(Equal(0))
+
+			var result map[string]any
+			Expect(json.Unmarshal(stdout.Contents(), &result)).To(Succeed())
+			Expect(result["success"]).To(BeTrue())
+			Expect(result["code"]).To(ContainSubstring(`console.log("/lib/foo.js");`))
+			Expect(result["integrity"]).To(HavePrefix("sha384-"))
+		})
+
+		It("prints errors", func() {
+			Expect(run("build", "lib/unknown.js", "-root", types.Config.RootPath)).To(Equal(1))
+			Expect(stderr).To(gbytes.Say(`error: Could not resolve "lib/unknown.js"`))
+		})
+
+		It("prints errors as JSON", func() {
+			Expect(run("build", "lib/unknown.js", "-root", types.Config.RootPath, "-json")).To(Equal(1))
+
+			var result map[string]any
+			Expect(json.Unmarshal(stdout.Contents(), &result)).To(Succeed())
+			Expect(result["success"]).To(BeFalse())
+			Expect(result["error"]).To(HaveKeyWithValue("Text", `Could not resolve "lib/unknown.js"`))
+		})
+	})
+
+	Describe("resolve", func() {
+		It("prints the URL and absolute paths", func() {
+			Expect(run("resolve", "lib/foo.js", "-root", types.Config.RootPath)).To(Equal(0))
+			Expect(stdout).To(gbytes.Say(`/lib/foo.js\n`))
+			Expect(stdout).To(gbytes.Say(path.Join(types.Config.RootPath, "lib/foo.js") + `\n`))
+		})
+
+		It("resolves relative to the importer", func() {
+			importer := path.Join(types.Config.RootPath, "lib/importing/app.js")
+			Expect(run("resolve", "../foo.js", "-importer", importer, "-root", types.Config.RootPath)).To(Equal(0))
+			Expect(stdout).To(gbytes.Say(`/lib/foo.js\n`))
+		})
+
+		It("prints the paths as JSON", func() {
+			Expect(run("resolve", "lib/foo.js", "-root", types.Config.RootPath, "-json")).To(Equal(0))
+
+			var result map[string]any
+			Expect(json.Unmarshal(stdout.Contents(), &result)).To(Succeed())
+			Expect(result).To(HaveKeyWithValue("urlPath", "/lib/foo.js"))
+			Expect(result).To(HaveKeyWithValue("absPath", path.Join(types.Config.RootPath, "lib/foo.js")))
+		})
+
+		It("prints errors", func() {
+			Expect(run("resolve", "unknown-pkg", "-root", types.Config.RootPath)).To(Equal(1))
+			Expect(stderr).To(gbytes.Say(`error: Could not resolve "unknown-pkg"`))
+		})
+	})
+
+	Describe("compile", func() {
+		It("compiles the precompile globs", func() {
+			code := run("compile", "-root", types.Config.RootPath, "-output-dir", types.Config.OutputDir,
+				"-precompile", "./lib/foo.js")
+
+			Expect(code).To(Equal(0), string(stderr.Contents()))
+			Expect(stdout).To(gbytes.Say(`Compiled successfully to public/assets`))
+		})
+
+		It("prints the result as JSON", func() {
+			code := run("compile", "-root", types.Config.RootPath, "-output-dir", types.Config.OutputDir,
+				"-precompile", "./lib/foo.js", "-json")
+
+			Expect(code).To(Equal(0), string(stderr.Contents()))
+
+			var result map[string]any
+			Expect(json.Unmarshal(stdout.Contents(), &result)).To(Succeed())
+			Expect(result).To(HaveKey("Errors"))
+		})
+
+		It("prints the timings of each group when sharded", func() {
+			code := run("compile", "-root", types.Config.RootPath, "-output-dir", types.Config.OutputDir,
+				"-precompile", "./lib/foo.js", "-shard")
+
+			Expect(code).To(Equal(0), string(stderr.Contents()))
+			Expect(stdout).To(gbytes.Say(`lib: \d+ms \(ok\)`))
+		})
+
+		It("fails when an entry point fails to build", func() {
+			dir := path.Join(types.Config.RootPath, "lib", "cli")
+			Expect(os.MkdirAll(dir, 0755)).To(Succeed())
+			DeferCleanup(os.RemoveAll, dir)
+			Expect(os.WriteFile(path.Join(dir, "broken.js"), []byte(`import "./unknown";`), 0644)).To(Succeed())
+
+			code := run("compile", "-root", types.Config.RootPath, "-output-dir", types.Config.OutputDir,
+				"-precompile", "./lib/cli/broken.js")
+
+			Expect(code).To(Equal(1))
+			Expect(stderr).To(gbytes.Say(`error: Could not resolve "./unknown"`))
+		})
+	})
+
+	Describe("watch", func() {
+		var dir string
+
+		BeforeEach(func() {
+			dir = path.Join(types.Config.RootPath, "lib", "cli_watch")
+			Expect(os.MkdirAll(dir, 0755)).To(Succeed())
+			Expect(os.WriteFile(path.Join(dir, "index.js"), []byte(`console.log("one");`), 0644)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+			os.RemoveAll(path.Join(types.Config.RootPath, types.Config.OutputDir, "lib", "cli_watch"))
+		})
+
+		watch := func(args ...string) (chan int, context.CancelFunc) {
+			ctx, cancel := context.WithCancel(context.Background())
+			args = append([]string{"watch", "-root", types.Config.RootPath, "-output-dir",
+				types.Config.OutputDir, "-precompile", "./lib/cli_watch/index.js"}, args...)
+
+			exitCode := make(chan int, 1)
+			go func() {
+				exitCode <- cli.Run(ctx, args, strings.NewReader(""), stdout, stderr)
+			}()
+
+			return exitCode, cancel
+		}
+
+		It("prints the changed outputs until stopped", func() {
+			exitCode, cancel := watch()
+
+			Eventually(stdout, "5s").Should(gbytes.Say(`changed: public/assets/lib/cli_watch/index`))
+			Eventually(stdout, "5s").Should(gbytes.Say(`Watching for changes`))
+
+			cancel()
+			Eventually(exitCode, "5s").Should(Receive(Equal(0)))
+		})
+
+		It("does not accept -shard", func() {
+			code := run("watch", "-root", types.Config.RootPath, "-precompile", "./lib/cli_watch/index.js", "-shard")
+
+			Expect(code).To(Equal(2))
+			Expect(stderr).To(gbytes.Say(`flag provided but not defined: -shard`))
+		})
+
+		It("prints each build as a line of JSON", func() {
+			exitCode, cancel := watch("-json")
+
+			Eventually(stdout, "5s").Should(gbytes.Say(`"Changed":\["public/assets/lib/cli_watch/index`))
+
+			cancel()
+			Eventually(exitCode, "5s").Should(Receive(Equal(0)))
+
+			line, _, _ := bytes.Cut(stdout.Contents(), []byte("\n"))
+			var event map[string]any
+			Expect(json.Unmarshal(line, &event)).To(Succeed())
+			Expect(event["Changed"]).NotTo(BeEmpty())
+		})
+	})
+})
@@ -1,8 +1,13 @@
 package proscenium_test
 
 import (
+	"encoding/json"
 	b "joelmoss/proscenium/internal/builder"
 	"joelmoss/proscenium/internal/types"
+	. "joelmoss/proscenium/test/support"
+	"os"
+	"path"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -15,7 +20,7 @@ var _ = Describe("BuildToString", func() {
 			"./app/models/**/*.jsx",
 		}
 
-		success, _ := b.Compile()
+		success, _ := b.Compile(&types.Config)
 
 		Expect(success).To(BeTrue())
 	})
@@ -26,8 +31,305 @@ var _ = Describe("BuildToString", func() {
 			"./app/components/css_module_import.module.css",
 		}
 
-		success, _ := b.Compile()
+		success, _ := b.Compile(&types.Config)
 
 		Expect(success).To(BeTrue())
 	})
+
+	It("writes a manifest of entry points", func() {
+		types.Config.Precompile = []string{"./app/components/css_module_import.js"}
+
+		success, _ := b.Compile(&types.Config)
+		Expect(success).To(BeTrue())
+
+		data, err := os.ReadFile(path.Join(types.Config.RootPath, types.Config.OutputDir, ".manifest.json"))
+		Expect(err).NotTo(HaveOccurred())
+
+		var manifest b.Manifest
+		Expect(json.Unmarshal(data, &manifest)).To(Succeed())
+
+		entry := manifest.Entries["/app/components/css_module_import.js"]
+		Expect(entry.File).To(MatchRegexp(`^/assets/app/components/css_module_import-\$[A-Z0-9]{8}\$\.js$`))
+		Expect(entry.Css).To(HaveLen(1))
+		Expect(entry.Css[0]).To(MatchRegexp(`^/assets/app/components/css_module_import-\$[A-Z0-9]{8}\$\.css$`))
+
+		file := manifest.Files[entry.File]
+		Expect(file.Integrity).To(HavePrefix("sha384-"))
+		Expect(file.Size).To(BeNumerically(">", 0))
+	})
+})
+
+var _ = Describe("Compile(sharded)", func() {
+	type groupResult struct {
+		Name   string
+		Errors []any
+	}
+
+	BeforeEach(func() {
+		types.Config.ShardCompile = true
+	})
+
+	It("builds each group of entry points", func() {
+		types.Config.Precompile = []string{
+			"./app/models/**/*.js",
+			"./app/models/**/*.jsx",
+			"./app/components/css_module_import.js",
+		}
+
+		success, result := b.Compile(&types.Config)
+		Expect(success).To(BeTrue(), result)
+
+		var compiled struct{ Groups []groupResult }
+		Expect(json.Unmarshal([]byte(result), &compiled)).To(Succeed())
+
+		Expect(compiled.Groups).To(HaveLen(2))
+		Expect(compiled.Groups[0].Name).To(Equal("app/models"))
+		Expect(compiled.Groups[1].Name).To(Equal("app/components"))
+	})
+
+	It("writes the outputs of each group", func() {
+		types.Config.Precompile = []string{
+			"./app/models/**/*.js",
+			"./app/components/css_module_import.js",
+		}
+
+		success, result := b.Compile(&types.Config)
+		Expect(success).To(BeTrue(), result)
+
+		data, err := os.ReadFile(path.Join(types.Config.RootPath, types.Config.OutputDir, ".manifest.json"))
+		Expect(err).NotTo(HaveOccurred())
+
+		var manifest b.Manifest
+		Expect(json.Unmarshal(data, &manifest)).To(Succeed())
+
+		Expect(manifest.Files).NotTo(BeEmpty())
+		for file := range manifest.Files {
+			Expect(path.Join(types.Config.RootPath, "public", file)).To(BeAnExistingFile())
+		}
+	})
+
+	It("reports the errors of each group", func() {
+		dir := path.Join(types.Config.RootPath, "lib", "shard")
+		Expect(os.MkdirAll(dir, 0755)).To(Succeed())
+		defer os.RemoveAll(dir)
+
+		Expect(os.WriteFile(path.Join(dir, "bad.js"), []byte(`console.log(`), 0644)).To(Succeed())
+
+		types.Config.Precompile = []string{"./app/models/**/*.js", "./lib/shard/*.js"}
+
+		success, result := b.Compile(&types.Config)
+		Expect(success).To(BeFalse())
+
+		var compiled struct{ Groups []groupResult }
+		Expect(json.Unmarshal([]byte(result), &compiled)).To(Succeed())
+
+		Expect(compiled.Groups[0].Errors).To(BeEmpty())
+		Expect(compiled.Groups[1].Name).To(Equal("lib/shard"))
+		Expect(compiled.Groups[1].Errors).NotTo(BeEmpty())
+	})
+})
+
+var _ = Describe("Compile(retained)", func() {
+	var dir string
+
+	compile := func(contents string) string {
+		GinkgoHelper()
+
+		Expect(os.WriteFile(path.Join(dir, "index.js"), []byte(contents), 0644)).To(Succeed())
+
+		success, result := b.Compile(&types.Config)
+		Expect(success).To(BeTrue(), result)
+
+		data, err := os.ReadFile(path.Join(types.Config.RootPath, types.Config.OutputDir, ".manifest.json"))
+		Expect(err).NotTo(HaveOccurred())
+
+		var manifest b.Manifest
+		Expect(json.Unmarshal(data, &manifest)).To(Succeed())
+
+		return path.Join(types.Config.RootPath, "public", manifest.Entries["/lib/retain/index.js"].File)
+	}
+
+	BeforeEach(func() {
+		dir = path.Join(types.Config.RootPath, "lib", "retain")
+		Expect(os.MkdirAll(dir, 0755)).To(Succeed())
+
+		types.Config.Precompile = []string{"./lib/retain/index.js"}
+		types.Config.RetainManifests = 1
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+		os.RemoveAll(path.Join(types.Config.RootPath, types.Config.OutputDir))
+	})
+
+	It("keeps the outputs of the retained manifests", func() {
+		first := compile(`console.log("one");`)
+		second := compile(`console.log("two");`)
+
+		Expect(first).NotTo(Equal(second))
+		Expect(first).To(BeAnExistingFile())
+		Expect(second).To(BeAnExistingFile())
+
+		third := compile(`console.log("three");`)
+
+		Expect(first).NotTo(BeAnExistingFile())
+		Expect(first + ".map").NotTo(BeAnExistingFile())
+		Expect(second).To(BeAnExistingFile())
+		Expect(third).To(BeAnExistingFile())
+	})
+})
+
+var _ = Describe("Compile(legacy)", func() {
+	BeforeEach(func() {
+		types.Config.Precompile = []string{"./lib/targets/optional_chaining.js"}
+		types.Config.LegacyTargets = []string{"es2017"}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(path.Join(types.Config.RootPath, types.Config.OutputDir))
+	})
+
+	It("compiles lowered outputs to the legacy directory", func() {
+		success, result := b.Compile(&types.Config)
+		Expect(success).To(BeTrue(), result)
+
+		data, err := os.ReadFile(path.Join(types.Config.RootPath, types.Config.OutputDir, ".manifest.json"))
+		Expect(err).NotTo(HaveOccurred())
+
+		var manifest b.Manifest
+		Expect(json.Unmarshal(data, &manifest)).To(Succeed())
+
+		modern := manifest.Entries["/lib/targets/optional_chaining.js"]
+		Expect(modern.File).To(HavePrefix("/assets/lib/targets/"))
+
+		Expect(manifest.Legacy).NotTo(BeNil())
+		legacy := manifest.Legacy.Entries["/lib/targets/optional_chaining.js"]
+		Expect(legacy.File).To(HavePrefix("/assets/legacy/lib/targets/"))
+		Expect(manifest.Legacy.Files).To(HaveKey(legacy.File))
+
+		code, err := os.ReadFile(path.Join(types.Config.RootPath, "public", legacy.File))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(code)).NotTo(ContainSubstring("?."))
+	})
+
+	It("compiles lowered CSS to the legacy directory", func() {
+		types.Config.Precompile = []string{"./lib/targets/nesting.css"}
+		types.Config.Targets = []string{"chrome120"}
+
+		success, result := b.Compile(&types.Config)
+		Expect(success).To(BeTrue(), result)
+
+		data, err := os.ReadFile(path.Join(types.Config.RootPath, types.Config.OutputDir, ".manifest.json"))
+		Expect(err).NotTo(HaveOccurred())
+
+		var manifest b.Manifest
+		Expect(json.Unmarshal(data, &manifest)).To(Succeed())
+
+		modern, err := os.ReadFile(path.Join(types.Config.RootPath, "public",
+			manifest.Entries["/lib/targets/nesting.css"].File))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(modern)).To(ContainCode(`.parent { .child { color: red; } }`))
+
+		legacy, err := os.ReadFile(path.Join(types.Config.RootPath, "public",
+			manifest.Legacy.Entries["/lib/targets/nesting.css"].File))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(legacy)).To(ContainCode(`.parent .child { color: red; }`))
+	})
+})
+
+var _ = Describe("Watch(unsupported)", func() {
+	BeforeEach(func() {
+		types.Config.Precompile = []string{"./lib/foo.js"}
+	})
+
+	It("rejects sharded compiles", func() {
+		types.Config.ShardCompile = true
+
+		stop, success, result := b.Watch(&types.Config, func(b.WatchEvent) {})
+
+		Expect(stop).To(BeNil())
+		Expect(success).To(BeFalse())
+		Expect(result).To(ContainSubstring("Unsupported watch options"))
+	})
+
+	It("rejects legacy targets", func() {
+		types.Config.LegacyTargets = []string{"es2015"}
+
+		_, success, result := b.Watch(&types.Config, func(b.WatchEvent) {})
+
+		Expect(success).To(BeFalse())
+		Expect(result).To(ContainSubstring("Unsupported watch options"))
+	})
+})
+
+var _ = Describe("Watch", func() {
+	var dir string
+	var stop func()
+	var events chan b.WatchEvent
+
+	writeFile := func(name string, contents string) {
+		GinkgoHelper()
+
+		filePath := path.Join(dir, name)
+		Expect(os.WriteFile(filePath, []byte(contents), 0644)).To(Succeed())
+
+		future := time.Now().Add(time.Second)
+		Expect(os.Chtimes(filePath, future, future)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		dir = path.Join(types.Config.RootPath, "lib", "watch")
+		Expect(os.MkdirAll(dir, 0755)).To(Succeed())
+
+		writeFile("dep.js", `export default "one";`)
+		writeFile("index.js", `import dep from "./dep"; console.log(dep);`)
+		writeFile("other.js", `console.log("other");`)
+
+		types.Config.Precompile = []string{"./lib/watch/index.js", "./lib/watch/other.js"}
+		events = make(chan b.WatchEvent, 10)
+
+		var success bool
+		var result string
+		stop, success, result = b.Watch(&types.Config, func(event b.WatchEvent) {
+			events <- event
+		})
+		Expect(success).To(BeTrue(), result)
+	})
+
+	AfterEach(func() {
+		stop()
+		os.RemoveAll(dir)
+		os.RemoveAll(path.Join(types.Config.RootPath, types.Config.OutputDir, "lib", "watch"))
+	})
+
+	It("writes all outputs on the initial build", func() {
+		var event b.WatchEvent
+		Eventually(events).Should(Receive(&event))
+
+		Expect(event.Errors).To(BeEmpty())
+		Expect(event.Changed).To(HaveLen(2))
+	})
+
+	It("writes source maps without listing them", func() {
+		var event b.WatchEvent
+		Eventually(events).Should(Receive(&event))
+
+		Expect(event.Changed).To(HaveEach(Not(HaveSuffix(".map"))))
+
+		for _, changed := range event.Changed {
+			Expect(path.Join(types.Config.RootPath, changed+".map")).To(BeAnExistingFile())
+		}
+	})
+
+	It("rewrites only the outputs affected by a change", func() {
+		Eventually(events).Should(Receive())
+
+		writeFile("dep.js", `export default "two";`)
+
+		var event b.WatchEvent
+		Eventually(events, "5s").Should(Receive(&event))
+
+		Expect(event.Changed).To(HaveLen(1))
+		Expect(event.Changed[0]).To(HavePrefix("public/assets/lib/watch/index"))
+	})
 })
@@ -0,0 +1,75 @@
+package proscenium_test
+
+import (
+	b "joelmoss/proscenium/internal/builder"
+	"joelmoss/proscenium/internal/types"
+	. "joelmoss/proscenium/test/support"
+	"sync"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ParseConfig", func() {
+	It("applies defaults", func() {
+		config, err := types.ParseConfig([]byte(`{"RootPath": "/app"}`))
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.RootPath).To(Equal("/app"))
+		Expect(config.Bundle).To(BeTrue())
+		Expect(config.CodeSplitting).To(BeTrue())
+	})
+
+	It("returns error on invalid JSON", func() {
+		_, err := types.ParseConfig([]byte(`{`))
+
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("accepts supported integrity algorithms", func() {
+		config, err := types.ParseConfig([]byte(`{"IntegrityAlgorithm": "sha512"}`))
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.IntegrityAlgorithm).To(Equal("sha512"))
+	})
+
+	It("returns error on an unsupported integrity algorithm", func() {
+		_, err := types.ParseConfig([]byte(`{"IntegrityAlgorithm": "sha348"}`))
+
+		Expect(err).To(MatchError(`unsupported IntegrityAlgorithm "sha348", expected one of [sha256 sha384 sha512]`))
+	})
+})
+
+var _ = Describe("BuildToString(concurrent configs)", func() {
+	It("builds each config independently", func() {
+		testConfig := types.Config
+		prodConfig := types.Config
+		prodConfig.Environment = types.ProdEnv
+
+		var wg sync.WaitGroup
+		results := make([]string, 10)
+
+		for i := range results {
+			wg.Go(func() {
+				defer GinkgoRecover()
+
+				config := &testConfig
+				if i%2 == 1 {
+					config = &prodConfig
+				}
+
+				_, results[i], _ = b.BuildToString(config, "lib/env/env.js")
+			})
+		}
+
+		wg.Wait()
+
+		for i, result := range results {
+			if i%2 == 1 {
+				Expect(result).To(ContainCode(`console.log("productionproduction");`))
+			} else {
+				Expect(result).To(ContainCode(`console.log("testtest");`))
+			}
+		}
+	})
+})
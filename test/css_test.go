@@ -1,11 +1,14 @@
 package proscenium_test
 
 import (
+	"encoding/json"
 	b "joelmoss/proscenium/internal/builder"
 	"joelmoss/proscenium/internal/types"
 	. "joelmoss/proscenium/test/support"
+	"os"
 	"path/filepath"
 
+	esbuild "github.com/joelmoss/esbuild-internal/api"
 	ast "github.com/joelmoss/esbuild-internal/ast"
 
 	. "github.com/onsi/ginkgo/v2"
@@ -229,14 +232,14 @@ var _ = Describe("BuildToString(css)", func() {
 		})
 
 		It("builds from npm install", func() {
-			_, code, _ := b.BuildToString("node_modules/@rubygems/gem_npm/index.css")
+			_, code, _ := b.BuildToString(&types.Config, "node_modules/@rubygems/gem_npm/index.css")
 
 			Expect(code).To(ContainCode(`.myClass {	color: pink; }`))
 		})
 
 		Context("css modules", func() {
 			It("builds from npm install", func() {
-				_, code, _ := b.BuildToString("node_modules/@rubygems/gem_npm/index.module.css")
+				_, code, _ := b.BuildToString(&types.Config, "node_modules/@rubygems/gem_npm/index.module.css")
 
 				abspath := filepath.Join(types.Config.RootPath, "vendor/gem_npm/index.module.css")
 				hsh := ast.CssLocalHash(abspath)
@@ -245,7 +248,7 @@ var _ = Describe("BuildToString(css)", func() {
 			})
 
 			It("builds from file:* npm install", func() {
-				_, code, _ := b.BuildToString("node_modules/@rubygems/gem_file/index.module.css")
+				_, code, _ := b.BuildToString(&types.Config, "node_modules/@rubygems/gem_file/index.module.css")
 
 				abspath := filepath.Join(types.Config.RootPath, "vendor/gem_file/index.module.css")
 				hsh := ast.CssLocalHash(abspath)
@@ -262,7 +265,7 @@ var _ = Describe("BuildToString(css)", func() {
 			It("builds npm install", func() {
 				addGem("gem_npm", "dummy/vendor")
 
-				_, code, _ := b.BuildToString("node_modules/@rubygems/gem_npm/index.module.css")
+				_, code, _ := b.BuildToString(&types.Config, "node_modules/@rubygems/gem_npm/index.module.css")
 
 				abspath := filepath.Join(types.Config.RootPath, "vendor/gem_npm/index.module.css")
 				hsh := ast.CssLocalHash(abspath)
@@ -312,13 +315,13 @@ var _ = Describe("BuildToString(css)", func() {
 			})
 
 			It("non css module", func() {
-				_, result, _ := b.BuildToString("app/components/css_import.js")
+				_, result, _ := b.BuildToString(&types.Config, "app/components/css_import.js")
 
 				Expect(result).To(ContainCode(`var css_import_default = {};`))
 			})
 
 			It("includes stylesheet and proxies class names", func() {
-				_, result, _ := b.BuildToString("lib/import_css_module.js")
+				_, result, _ := b.BuildToString(&types.Config, "lib/import_css_module.js")
 
 				abspath := filepath.Join(types.Config.RootPath, "lib/styles.module.css")
 				hsh := ast.CssLocalHash(abspath)
@@ -327,7 +330,7 @@ var _ = Describe("BuildToString(css)", func() {
 			})
 
 			It("import relative css module from js", func() {
-				_, result, _ := b.BuildToString("lib/import_relative_css_module.js")
+				_, result, _ := b.BuildToString(&types.Config, "lib/import_relative_css_module.js")
 
 				abspath := filepath.Join(types.Config.RootPath, "lib/styles.module.css")
 				hsh := ast.CssLocalHash(abspath)
@@ -342,13 +345,13 @@ var _ = Describe("BuildToString(css)", func() {
 			})
 
 			It("import relative css module from js", func() {
-				_, result, _ := b.BuildToString("lib/import_relative_css_module.js")
+				_, result, _ := b.BuildToString(&types.Config, "lib/import_relative_css_module.js")
 
 				Expect(result).To(ContainCode(`import styles from "/lib/styles.module.css";`))
 			})
 
 			It("includes stylesheet and proxies class names", func() {
-				_, result, _ := b.BuildToString("lib/import_css_module.js")
+				_, result, _ := b.BuildToString(&types.Config, "lib/import_css_module.js")
 
 				Expect(result).To(ContainCode(`import styles from "/lib/styles.module.css";`))
 			})
@@ -356,7 +359,7 @@ var _ = Describe("BuildToString(css)", func() {
 
 		When("importing css module from css module", func() {
 			It("should use the same ident for all class names", func() {
-				_, result, _ := b.BuildToString("lib/css_modules/import_css_module.module.css")
+				_, result, _ := b.BuildToString(&types.Config, "lib/css_modules/import_css_module.module.css")
 
 				abspath := filepath.Join(types.Config.RootPath, "lib/css_modules/import_css_module.module.css")
 				hsh := ast.CssLocalHash(abspath)
@@ -366,13 +369,84 @@ var _ = Describe("BuildToString(css)", func() {
 			})
 		})
 
+		When("CssModuleExports = true", func() {
+			var className = func(name string) string {
+				abspath := filepath.Join(types.Config.RootPath, "lib/css_module_exports/styles.module.css")
+				return name + "_" + ast.CssLocalHash(abspath) + "_lib-css_module_exports-styles-module"
+			}
+
+			BeforeEach(func() {
+				types.Config.CssModuleExports = true
+			})
+
+			It("exports class names as named and default exports", func() {
+				_, result, _ := b.BuildToString(&types.Config, "lib/css_module_exports/index.js")
+
+				Expect(result).To(ContainCode(`var button = "` + className("button") + `";`))
+				Expect(result).To(ContainCode(`"nav-item": "` + className("nav-item") + `"`))
+				Expect(result).NotTo(ContainSubstring(`new Proxy`))
+			})
+
+			It("tree shakes unused named exports", func() {
+				_, result, _ := b.BuildToString(&types.Config, "lib/css_module_exports/index.js")
+
+				Expect(result).NotTo(ContainSubstring(`var unused`))
+			})
+
+			It("includes the class names that are composed", func() {
+				_, result, _ := b.BuildToString(&types.Config, "lib/css_module_exports/index.js")
+
+				Expect(result).To(MatchRegexp(`primary: "[^"]*` + className("button")))
+			})
+
+			It("exports unknown class names as undefined", func() {
+				success, result, _ := b.BuildToString(&types.Config, "lib/css_module_exports/unknown.js")
+
+				Expect(success).To(BeTrue(), result)
+				Expect(result).To(ContainCode(`var buton = undefined;`))
+			})
+
+			It("exports class names added since the last build", func() {
+				dir := filepath.Join(types.Config.RootPath, "lib/css_module_exports/changed")
+				Expect(os.MkdirAll(dir, 0755)).To(Succeed())
+				DeferCleanup(os.RemoveAll, dir)
+
+				Expect(os.WriteFile(filepath.Join(dir, "index.js"),
+					[]byte(`import { added } from "./styles.module.css";\nconsole.log(added);`), 0644)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(dir, "styles.module.css"),
+					[]byte(`.button { color: pink; }`), 0644)).To(Succeed())
+
+				_, result, _ := b.BuildToString(&types.Config, "lib/css_module_exports/changed/index.js")
+				Expect(result).To(ContainCode(`var added = undefined;`))
+
+				Expect(os.WriteFile(filepath.Join(dir, "styles.module.css"),
+					[]byte(`.button { color: pink; } .added { color: red; }`), 0644)).To(Succeed())
+
+				_, result, _ = b.BuildToString(&types.Config, "lib/css_module_exports/changed/index.js")
+				Expect(result).To(MatchRegexp(`var added = "added_[^"]+";`))
+			})
+
+			It("warns when importing an unknown class name", func() {
+				types.Config.Precompile = []string{"./lib/css_module_exports/unknown.js"}
+				DeferCleanup(os.RemoveAll, filepath.Join(types.Config.RootPath, types.Config.OutputDir))
+
+				success, result := b.Compile(&types.Config)
+				Expect(success).To(BeTrue(), result)
+
+				var compiled struct{ Warnings []esbuild.Message }
+				Expect(json.Unmarshal([]byte(result), &compiled)).To(Succeed())
+				Expect(compiled.Warnings).To(ContainElement(HaveField("Text",
+					`No matching class name in "./styles.module.css" for import "buton"`)))
+			})
+		})
+
 		Context("internal @rubygems/*", func() {
 			BeforeEach(func() {
 				addGem("gem1", "dummy/vendor")
 			})
 
 			It("includes stylesheet and proxies class names", func() {
-				_, result, _ := b.BuildToString("lib/rubygems/internal_import_css_module.js")
+				_, result, _ := b.BuildToString(&types.Config, "lib/rubygems/internal_import_css_module.js")
 
 				abspath := filepath.Join(types.Config.RootPath, "vendor/gem1/styles.module.css")
 				hsh := ast.CssLocalHash(abspath)
@@ -389,7 +463,7 @@ var _ = Describe("BuildToString(css)", func() {
 			})
 
 			It("includes stylesheet and proxies class names", func() {
-				_, result, _ := b.BuildToString("lib/rubygems/external_import_css_module.js")
+				_, result, _ := b.BuildToString(&types.Config, "lib/rubygems/external_import_css_module.js")
 
 				abspath := filepath.Join(types.Config.RootPath, "../external/gem2/styles.module.css")
 				hsh := ast.CssLocalHash(abspath)
@@ -0,0 +1,100 @@
+package proscenium_test
+
+import (
+	b "joelmoss/proscenium/internal/builder"
+	"joelmoss/proscenium/internal/types"
+	"os"
+	"path"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CheckFresh", func() {
+	var dir string
+
+	writeFile := func(name string, contents string) {
+		GinkgoHelper()
+
+		filePath := path.Join(dir, name)
+		Expect(os.WriteFile(filePath, []byte(contents), 0644)).To(Succeed())
+
+		future := time.Now().Add(time.Second)
+		Expect(os.Chtimes(filePath, future, future)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		dir = path.Join(types.Config.RootPath, "lib", "fresh")
+		Expect(os.MkdirAll(dir, 0755)).To(Succeed())
+
+		writeFile("dep.js", `export default "one";`)
+		writeFile("index.js", `import dep from "./dep"; console.log(dep);`)
+	})
+
+	AfterEach(func() {
+		b.ResetFreshness()
+		os.RemoveAll(dir)
+	})
+
+	It("forgets the ETags of the least recently checked paths beyond the limit", func() {
+		types.Config.IncrementalLimit = 1
+
+		_, _, _, indexEtag := b.BuildToStringWithETag(&types.Config, "lib/fresh/index.js")
+		_, _, _, depEtag := b.BuildToStringWithETag(&types.Config, "lib/fresh/dep.js")
+
+		Expect(b.CheckFresh(&types.Config, "lib/fresh/index.js", indexEtag)).To(BeFalse())
+		Expect(b.CheckFresh(&types.Config, "lib/fresh/dep.js", depEtag)).To(BeTrue())
+	})
+
+	It("is fresh when no inputs have changed", func() {
+		_, _, _, etag := b.BuildToStringWithETag(&types.Config, "lib/fresh/index.js")
+
+		Expect(etag).NotTo(BeEmpty())
+		Expect(b.CheckFresh(&types.Config, "lib/fresh/index.js", etag)).To(BeTrue())
+	})
+
+	It("is fresh when an input is touched without changes", func() {
+		_, _, _, etag := b.BuildToStringWithETag(&types.Config, "lib/fresh/index.js")
+
+		writeFile("dep.js", `export default "one";`)
+
+		Expect(b.CheckFresh(&types.Config, "lib/fresh/index.js", etag)).To(BeTrue())
+	})
+
+	It("is stale when an input has changed", func() {
+		_, _, _, etag := b.BuildToStringWithETag(&types.Config, "lib/fresh/index.js")
+
+		writeFile("dep.js", `export default "two";`)
+
+		Expect(b.CheckFresh(&types.Config, "lib/fresh/index.js", etag)).To(BeFalse())
+
+		_, _, _, etag2 := b.BuildToStringWithETag(&types.Config, "lib/fresh/index.js")
+		Expect(etag2).NotTo(Equal(etag))
+	})
+
+	It("returns the same ETag when rebuilt without changes", func() {
+		_, _, _, etag := b.BuildToStringWithETag(&types.Config, "lib/fresh/index.js")
+		Expect(etag).NotTo(BeEmpty())
+
+		writeFile("dep.js", `export default "one";`)
+
+		_, _, _, etag2 := b.BuildToStringWithETag(&types.Config, "lib/fresh/index.js")
+		Expect(etag2).To(Equal(etag))
+	})
+
+	It("is stale when the ETag does not match", func() {
+		b.BuildToString(&types.Config, "lib/fresh/index.js")
+
+		Expect(b.CheckFresh(&types.Config, "lib/fresh/index.js", `"abc"`)).To(BeFalse())
+	})
+
+	It("is stale when the config has changed", func() {
+		_, _, _, etag := b.BuildToStringWithETag(&types.Config, "lib/fresh/index.js")
+
+		prodConfig := types.Config
+		prodConfig.Environment = types.ProdEnv
+
+		Expect(b.CheckFresh(&prodConfig, "lib/fresh/index.js", etag)).To(BeFalse())
+	})
+})
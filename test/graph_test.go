@@ -0,0 +1,66 @@
+package proscenium_test
+
+import (
+	b "joelmoss/proscenium/internal/builder"
+	"joelmoss/proscenium/internal/types"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DependencyGraph", func() {
+	It("includes dynamic imports", func() {
+		types.Config.CodeSplitting = true
+
+		graph, err := b.DependencyGraph(&types.Config, "lib/graph/index.js")
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(graph.File).To(Equal("/lib/graph/index.js"))
+		Expect(graph.DynamicImports).To(ConsistOf(MatchRegexp(`(?i)^/lib/graph/lazy-\$[A-Z0-9]+\$\.js$`)))
+	})
+
+	It("includes unbundled imports", func() {
+		types.Config.Bundle = false
+
+		graph, err := b.DependencyGraph(&types.Config, "lib/importing/package.js")
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(graph.Imports).To(ContainElements(
+			"/node_modules/pkg/one.js",
+			"/node_modules/pkg/two.js",
+			"/node_modules/pkg/index.js",
+		))
+		Expect(graph.DynamicImports).To(BeEmpty())
+	})
+
+	It("includes unbundled stylesheets", func() {
+		types.Config.Bundle = false
+
+		graph, err := b.DependencyGraph(&types.Config, "lib/importing/package.css")
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(graph.Css).To(ContainElement("/node_modules/pkg/one.css"))
+	})
+
+	It("finds the output of entry points within Ruby gems", func() {
+		types.Config.Bundle = false
+		addGem("gem1", "dummy/vendor")
+		addGem("gem3", "dummy/vendor")
+		addGem("gem4", "external")
+
+		graph, err := b.DependencyGraph(&types.Config, "node_modules/@rubygems/gem3/lib/gem3/gem3.js")
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(graph.File).To(Equal("/node_modules/@rubygems/gem3/lib/gem3/gem3.js"))
+		Expect(graph.Imports).To(ContainElements(
+			"/node_modules/@rubygems/gem3/lib/gem3/imported.js",
+			"/node_modules/@rubygems/gem1/lib/gem1/console.js",
+		))
+	})
+
+	It("returns build errors", func() {
+		_, err := b.DependencyGraph(&types.Config, "lib/graph/unknown.js")
+
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -2,6 +2,7 @@ package proscenium_test
 
 import (
 	b "joelmoss/proscenium/internal/builder"
+	"joelmoss/proscenium/internal/types"
 	. "joelmoss/proscenium/test/support"
 	"testing"
 
@@ -11,7 +12,7 @@ import (
 
 var _ = Describe("b.BuildToString(i18n)", func() {
 	It("exports json", func() {
-		_, code, _ := b.BuildToString("lib/i18n/benchmark/index.js")
+		_, code, _ := b.BuildToString(&types.Config, "lib/i18n/benchmark/index.js")
 
 		Expect(code).To(ContainCode(`
 			{ firstName: "Joel", foo: { bar: { baz: 1 } }, lastName: "Moss" }
@@ -21,7 +22,7 @@ var _ = Describe("b.BuildToString(i18n)", func() {
 
 func BenchmarkI18n(bm *testing.B) {
 	for bm.Loop() {
-		success, result, _ := b.BuildToString("lib/i18n/benchmark/index.js")
+		success, result, _ := b.BuildToString(&types.Config, "lib/i18n/benchmark/index.js")
 
 		if !success {
 			panic("Build failed: " + result)
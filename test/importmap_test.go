@@ -0,0 +1,111 @@
+package proscenium_test
+
+import (
+	b "joelmoss/proscenium/internal/builder"
+	"joelmoss/proscenium/internal/plugin"
+	"joelmoss/proscenium/internal/types"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ImportMap", func() {
+	pkgRealPath := "/node_modules/.pnpm/pkg@git+https+++git@gist.github.com+c3d9087f5f214e1f0d9719e4a7d38474" +
+		".git+2a499df3143c5637ebaa3be5c4b983ebc094aeff/node_modules"
+
+	BeforeEach(func() {
+		types.Config.Bundle = false
+		types.Config.ImportMap = true
+	})
+
+	AfterEach(func() {
+		plugin.ResetImportMaps()
+	})
+
+	It("leaves mapped bare specifiers intact", func() {
+		_, code, _ := b.BuildToString(&types.Config, "lib/importing/package.js")
+
+		Expect(code).To(ContainSubstring(`import "pkg/one.js";`))
+		Expect(code).To(ContainSubstring(`import "pkg";`))
+		Expect(code).NotTo(ContainSubstring(`import "/node_modules/pkg/one.js";`))
+	})
+
+	It("rewrites unmapped bare specifiers to their URL path", func() {
+		_, code, _ := b.BuildToString(&types.Config, "lib/importing/package.js")
+
+		Expect(code).To(ContainSubstring(`import "/node_modules/pkg/two.js";`))
+	})
+
+	It("maps the dependencies in package.json without building them", func() {
+		importMap := plugin.ImportMap(&types.Config)
+		Expect(importMap.Imports).To(HaveKeyWithValue("pkg", "/node_modules/pkg/index.js"))
+		Expect(importMap.Imports).To(HaveKeyWithValue("pkg/", "/node_modules/pkg/"))
+		Expect(importMap.Imports).To(HaveKeyWithValue("react", "/node_modules/react/index.js"))
+		Expect(importMap.Imports).To(HaveKeyWithValue("react/jsx-runtime", "/node_modules/react/jsx-runtime.js"))
+	})
+
+	It("is the same before and after building", func() {
+		before := plugin.ImportMap(&types.Config)
+
+		plugin.ResetImportMaps()
+		b.BuildToString(&types.Config, "lib/importing/package.js")
+		b.BuildToString(&types.Config, "pkg/dependency")
+
+		Expect(plugin.ImportMap(&types.Config)).To(Equal(before))
+	})
+
+	It("maps the dependencies of packages to their scope", func() {
+		importMap := plugin.ImportMap(&types.Config)
+		Expect(importMap.Scopes).To(HaveKeyWithValue("/node_modules/pkg/", Equal(map[string]string{
+			"pkg_dep":  pkgRealPath + "/pkg_dep/index.js",
+			"pkg_dep/": pkgRealPath + "/pkg_dep/",
+		})))
+	})
+
+	It("leaves imports from within packages intact", func() {
+		_, code, _ := b.BuildToString(&types.Config, "pkg/dependency")
+
+		Expect(code).To(ContainSubstring(`import "pkg_dep";`))
+	})
+
+	It("maps ruby gems", func() {
+		addGem("gem1", "dummy/vendor")
+
+		importMap := plugin.ImportMap(&types.Config)
+		Expect(importMap.Imports).To(HaveKeyWithValue(
+			"@rubygems/gem1/", "/node_modules/@rubygems/gem1/",
+		))
+	})
+
+	It("maps packages installed since it was built", func() {
+		root := GinkgoT().TempDir()
+		types.Config.RootPath = root
+
+		install := func(name string, dependencies string) {
+			GinkgoHelper()
+
+			pkgDir := filepath.Join(root, "node_modules", name)
+			Expect(os.MkdirAll(pkgDir, 0755)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(pkgDir, "package.json"),
+				[]byte(`{ "name": "`+name+`", "main": "index.js" }`), 0644)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(pkgDir, "index.js"), []byte(`export default 1;`), 0644)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(root, "package.json"),
+				[]byte(`{ "dependencies": { `+dependencies+` } }`), 0644)).To(Succeed())
+		}
+
+		install("one", `"one": "1.0.0"`)
+		Expect(plugin.ImportMap(&types.Config).Imports).To(HaveKeyWithValue("one", "/node_modules/one/index.js"))
+
+		install("two", `"one": "1.0.0", "two": "1.0.0"`)
+		Expect(plugin.ImportMap(&types.Config).Imports).To(HaveKeyWithValue("two", "/node_modules/two/index.js"))
+	})
+
+	It("requires bundling to be disabled", func() {
+		types.Config.Bundle = true
+
+		_, err := b.ImportMap(&types.Config)
+		Expect(err).To(HaveOccurred())
+	})
+})
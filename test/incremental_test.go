@@ -0,0 +1,114 @@
+package proscenium_test
+
+import (
+	b "joelmoss/proscenium/internal/builder"
+	"joelmoss/proscenium/internal/types"
+	. "joelmoss/proscenium/test/support"
+	"os"
+	"path"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("BuildToString(incremental)", func() {
+	var dir string
+
+	writeFile := func(name string, contents string) {
+		GinkgoHelper()
+
+		filePath := path.Join(dir, name)
+		Expect(os.WriteFile(filePath, []byte(contents), 0644)).To(Succeed())
+
+		// Ensure the modification time differs from that of the previous write.
+		future := time.Now().Add(time.Second)
+		Expect(os.Chtimes(filePath, future, future)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		types.Config.Incremental = true
+
+		dir = path.Join(types.Config.RootPath, "lib", "incremental")
+		Expect(os.MkdirAll(dir, 0755)).To(Succeed())
+
+		writeFile("dep.js", `export default "one";`)
+		writeFile("index.js", `import dep from "./dep"; console.log(dep);`)
+	})
+
+	AfterEach(func() {
+		b.DisposeIncremental()
+		os.RemoveAll(dir)
+	})
+
+	It("returns the same result when nothing has changed", func() {
+		success, code, hash := b.BuildToString(&types.Config, "lib/incremental/index.js")
+		Expect(success).To(BeTrue())
+		Expect(code).To(ContainCode(`console.log("one");`))
+
+		success, code2, hash2 := b.BuildToString(&types.Config, "lib/incremental/index.js")
+		Expect(success).To(BeTrue())
+		Expect(code2).To(Equal(code))
+		Expect(hash2).To(Equal(hash))
+	})
+
+	It("disposes of the least recently used contexts beyond the limit", func() {
+		types.Config.IncrementalLimit = 1
+
+		_, code, _ := b.BuildToString(&types.Config, "lib/incremental/index.js")
+		Expect(code).To(ContainCode(`console.log("one");`))
+		Expect(b.IncrementalContexts()).To(Equal(1))
+
+		_, code, _ = b.BuildToString(&types.Config, "lib/incremental/dep.js")
+		Expect(code).To(ContainCode(`"one"`))
+		Expect(b.IncrementalContexts()).To(Equal(1))
+
+		_, code, _ = b.BuildToString(&types.Config, "lib/incremental/index.js")
+		Expect(code).To(ContainCode(`console.log("one");`))
+		Expect(b.IncrementalContexts()).To(Equal(1))
+	})
+
+	It("forgets the hashes of files that recent builds did not depend on", func() {
+		types.Config.IncrementalLimit = 1
+
+		b.BuildToString(&types.Config, "lib/incremental/index.js")
+		hashed := b.HashedFiles()
+		Expect(hashed).To(BeNumerically(">=", 2))
+
+		b.BuildToString(&types.Config, "lib/incremental/dep.js")
+		Expect(b.HashedFiles()).To(BeNumerically("<", hashed))
+	})
+
+	It("rebuilds when a dependency changes", func() {
+		_, code, _ := b.BuildToString(&types.Config, "lib/incremental/index.js")
+		Expect(code).To(ContainCode(`console.log("one");`))
+
+		writeFile("dep.js", `export default "two";`)
+
+		_, code, _ = b.BuildToString(&types.Config, "lib/incremental/index.js")
+		Expect(code).To(ContainCode(`console.log("two");`))
+	})
+
+	It("does not rebuild when a dependency is touched without changes", func() {
+		_, code, hash := b.BuildToString(&types.Config, "lib/incremental/index.js")
+
+		writeFile("dep.js", `export default "one";`)
+
+		_, code2, hash2 := b.BuildToString(&types.Config, "lib/incremental/index.js")
+		Expect(code2).To(Equal(code))
+		Expect(hash2).To(Equal(hash))
+	})
+
+	It("rebuilds when a mixin file changes", func() {
+		writeFile("mixins.css", `@define-mixin red { color: red; }`)
+		writeFile("index.css", `body { @mixin red from url("/lib/incremental/mixins.css"); }`)
+
+		_, code, _ := b.BuildToString(&types.Config, "lib/incremental/index.css")
+		Expect(code).To(ContainCode(`body { color: red; }`))
+
+		writeFile("mixins.css", `@define-mixin red { color: darkred; }`)
+
+		_, code, _ = b.BuildToString(&types.Config, "lib/incremental/index.css")
+		Expect(code).To(ContainCode(`body { color: darkred; }`))
+	})
+})
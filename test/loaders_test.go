@@ -0,0 +1,50 @@
+package proscenium_test
+
+import (
+	b "joelmoss/proscenium/internal/builder"
+	"joelmoss/proscenium/internal/types"
+	. "joelmoss/proscenium/test/support"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Loaders", func() {
+	BeforeEach(func() {
+		types.Config.Loaders = map[string]string{".txt": "text", ".glsl": "text"}
+	})
+
+	It("loads files with the configured loader", func() {
+		_, code, _ := b.BuildToString(&types.Config, "lib/loaders/index.js")
+
+		Expect(code).To(ContainCode(`var hello_default = "Hello\n";`))
+		Expect(code).To(ContainCode(`var shader_default = "void main() {}\n";`))
+	})
+
+	It("bundles files with the configured loader when unbundling", func() {
+		types.Config.Bundle = false
+
+		_, code, _ := b.BuildToString(&types.Config, "lib/loaders/index.js")
+
+		Expect(code).To(ContainCode(`var hello_default = "Hello\n";`))
+		Expect(code).NotTo(ContainSubstring(`import hello from`))
+	})
+
+	It("errors on unsupported loaders", func() {
+		types.Config.Loaders = map[string]string{".txt": "markdown"}
+
+		success, code, _ := b.BuildToString(&types.Config, "lib/loaders/index.js")
+
+		Expect(success).To(BeFalse())
+		Expect(code).To(ContainSubstring(`Unsupported loader \"markdown\" for \".txt\"`))
+	})
+
+	It("errors on extensions without a dot", func() {
+		types.Config.Loaders = map[string]string{"txt": "text"}
+
+		success, code, _ := b.BuildToString(&types.Config, "lib/loaders/index.js")
+
+		Expect(success).To(BeFalse())
+		Expect(code).To(ContainSubstring(`must begin with a dot`))
+	})
+})
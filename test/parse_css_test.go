@@ -1,8 +1,12 @@
 package proscenium_test
 
 import (
+	"encoding/base64"
+	"encoding/json"
 	"joelmoss/proscenium/internal/css"
+	"joelmoss/proscenium/internal/types"
 	. "joelmoss/proscenium/test/support"
+	"path"
 	"strings"
 
 	"github.com/MakeNowJust/heredoc"
@@ -16,6 +20,28 @@ var _ = Describe("Build(parseCss)", func() {
 			Expect("body{}").To(BeParsedTo("body{}", "/foo.css"))
 		})
 
+		It("should pass through at-rules, comments and nested rules", func() {
+			Expect(`
+				@import url("/foo.css") layer(base);
+				/* comment { } */
+				@media (min-width: 10px) {
+					a:hover, a[href="{"] {
+						color: red;
+						& > span { --empty:; }
+					}
+				}
+			`).To(BeParsedTo(`
+				@import url("/foo.css") layer(base);
+				/* comment { } */
+				@media (min-width: 10px) {
+					a:hover, a[href="{"] {
+						color: red;
+						& > span { --empty:; }
+					}
+				}
+			`, "/foo.css"))
+		})
+
 		Describe("mixins", func() {
 			Describe("local", func() {
 				It("undefined mixin is passed through", func() {
@@ -36,7 +62,7 @@ var _ = Describe("Build(parseCss)", func() {
 							@mixin foo;
 						}
 					`))
-					_, warnings, err := css.ParseCss(input, "/foo.css")
+					_, warnings, err := css.ParseCss(&types.Config, input, "/foo.css")
 					Expect(err).NotTo(HaveOccurred())
 					Expect(warnings).To(HaveLen(1))
 					Expect(warnings[0].Text).To(Equal(`Mixin "foo" not defined in "/foo.css"`))
@@ -47,6 +73,45 @@ var _ = Describe("Build(parseCss)", func() {
 					Expect(warnings[0].LineText).To(Equal("\t@mixin foo;"))
 				})
 
+				It("warnings have the exact position of the mixin", func() {
+					input := strings.TrimSpace(heredoc.Doc(`
+						@define-mixin large-button {
+							font-size: 20px;
+							padding: 10px 20px;
+						}
+						header {
+							@mixin large-button;
+							@mixin foo;
+						}
+						footer { @mixin foo; }
+					`))
+					_, warnings, err := css.ParseCss(&types.Config, input, "/foo.css")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(warnings).To(HaveLen(2))
+					Expect(warnings[0].Line).To(Equal(7))
+					Expect(warnings[0].Column).To(Equal(1))
+					Expect(warnings[1].Line).To(Equal(9))
+					Expect(warnings[1].Column).To(Equal(9))
+					Expect(warnings[1].Length).To(Equal(len("@mixin foo")))
+					Expect(warnings[1].LineText).To(Equal("footer { @mixin foo; }"))
+				})
+
+				It("mixin that includes itself generates a warning", func() {
+					input := strings.TrimSpace(heredoc.Doc(`
+						@define-mixin button {
+							@mixin button;
+						}
+						header {
+							@mixin button;
+						}
+					`))
+					_, warnings, err := css.ParseCss(&types.Config, input, "/foo.css")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(warnings).To(HaveLen(1))
+					Expect(warnings[0].Text).To(Equal(`Mixin "button" includes itself`))
+					Expect(warnings[0].Line).To(Equal(2))
+				})
+
 				It("mixin not defined at root level is passed through", func() {
 					Expect(`
 						header {
@@ -109,6 +174,122 @@ var _ = Describe("Build(parseCss)", func() {
 				})
 			})
 
+			Describe("arguments", func() {
+				It("replaces parameters with arguments", func() {
+					Expect(`
+						@define-mixin button $color, $size {
+							color: $color;
+							.icon-$size { font-size: $size; }
+						}
+						header {
+							@mixin button red, 2rem;
+						}
+					`).To(BeParsedTo(`
+						header {
+							color: red;
+							.icon-2rem { font-size: 2rem; }
+						}
+					`, "/foo.css"))
+				})
+
+				It("uses default values of omitted arguments", func() {
+					Expect(`
+						@define-mixin button $color, $size: calc(1rem + 2px) {
+							color: $color;
+							font-size: $size;
+						}
+						header {
+							@mixin button rgb(0, 0, 0);
+						}
+					`).To(BeParsedTo(`
+						header {
+							color: rgb(0, 0, 0);
+							font-size: calc(1rem + 2px);
+						}
+					`, "/foo.css"))
+				})
+
+				It("passes arguments to nested mixins", func() {
+					Expect(`
+						@define-mixin color $color {
+							color: $color;
+						}
+						@define-mixin button $color {
+							@mixin color $color;
+						}
+						header {
+							@mixin button blue;
+						}
+					`).To(BeParsedTo(`
+						header {
+							color: blue;
+						}
+					`, "/foo.css"))
+				})
+
+				It("does not replace variables in strings", func() {
+					Expect(`
+						@define-mixin button $color {
+							content: "$color";
+						}
+						header {
+							@mixin button blue;
+						}
+					`).To(BeParsedTo(`
+						header {
+							content: "$color";
+						}
+					`, "/foo.css"))
+				})
+
+				It("includes mixins from url() with arguments", func() {
+					Expect(`
+						header {
+							@mixin button pink from url("/lib/mixins/buttons.css");
+						}
+					`).To(BeParsedTo(`
+						header {
+							color: pink;
+							font-size: 1rem;
+						}
+					`, "/foo.css"))
+				})
+
+				It("missing argument generates a warning", func() {
+					input := strings.TrimSpace(heredoc.Doc(`
+						@define-mixin button $color, $size: 1rem {
+							color: $color;
+						}
+						header {
+							@mixin button;
+						}
+					`))
+					output, warnings, err := css.ParseCss(&types.Config, input, "/foo.css")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(output).To(ContainSubstring("@mixin button;"))
+					Expect(warnings).To(HaveLen(1))
+					Expect(warnings[0].Text).To(Equal(`Missing argument $color for mixin "button"`))
+					Expect(warnings[0].Line).To(Equal(5))
+					Expect(warnings[0].Column).To(Equal(1))
+					Expect(warnings[0].Length).To(Equal(len("@mixin button")))
+				})
+
+				It("too many arguments generates a warning", func() {
+					input := strings.TrimSpace(heredoc.Doc(`
+						@define-mixin button $color {
+							color: $color;
+						}
+						header {
+							@mixin button red, blue;
+						}
+					`))
+					_, warnings, err := css.ParseCss(&types.Config, input, "/foo.css")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(warnings).To(HaveLen(1))
+					Expect(warnings[0].Text).To(Equal(`Mixin "button" accepts 1 arguments, but was given 2`))
+				})
+			})
+
 			Describe("from url()", func() {
 				EntryPoint("lib/importing/mixins.css", func() {
 					Describe("from absolute url", func() {
@@ -161,7 +342,7 @@ var _ = Describe("Build(parseCss)", func() {
 									@mixin undefMixin from url("@rubygems/gem1/table.css");
 								}
 							`))
-							_, warnings, err := css.ParseCss(input, "/foo.css")
+							_, warnings, err := css.ParseCss(&types.Config, input, "/foo.css")
 							Expect(err).NotTo(HaveOccurred())
 							Expect(warnings).To(HaveLen(1))
 							Expect(warnings[0].Text).To(ContainSubstring(`Mixin "undefMixin" not found in`))
@@ -239,7 +420,7 @@ var _ = Describe("Build(parseCss)", func() {
 								@mixin red from url("/unknown.css");
 							}
 						`))
-						_, warnings, err := css.ParseCss(input, "/foo.css")
+						_, warnings, err := css.ParseCss(&types.Config, input, "/foo.css")
 						Expect(err).NotTo(HaveOccurred())
 						Expect(warnings).To(HaveLen(1))
 						Expect(warnings[0].Text).To(Equal(`Could not resolve mixin file "/unknown.css" for mixin "red"`))
@@ -270,7 +451,7 @@ var _ = Describe("Build(parseCss)", func() {
 								@mixin unknown from url("/lib/mixins/colors.css");
 							}
 						`))
-						_, warnings, err := css.ParseCss(input, "/foo.css")
+						_, warnings, err := css.ParseCss(&types.Config, input, "/foo.css")
 						Expect(err).NotTo(HaveOccurred())
 						Expect(warnings).To(HaveLen(1))
 						Expect(warnings[0].Text).To(ContainSubstring(`Mixin "unknown" not found in`))
@@ -327,5 +508,221 @@ var _ = Describe("Build(parseCss)", func() {
 				})
 			})
 		})
+
+		Describe("custom media", func() {
+			It("replaces custom media queries", func() {
+				Expect(`
+					@custom-media --small (max-width: 30em);
+					@media (--small) and (orientation: landscape) {
+						header { color: red; }
+					}
+				`).To(BeParsedTo(`
+					@media (max-width: 30em) and (orientation: landscape) {
+						header { color: red; }
+					}
+				`, "/foo.css"))
+			})
+
+			It("can be used before it is defined", func() {
+				Expect(`
+					header {
+						@media (--small) { color: red; }
+					}
+					@custom-media --small screen and (max-width: 30em);
+				`).To(BeParsedTo(`
+					header {
+						@media screen and (max-width: 30em) { color: red; }
+					}
+				`, "/foo.css"))
+			})
+
+			It("imports custom media from url()", func() {
+				Expect(`
+					@custom-media --small-landscape from url("/lib/custom_media/breakpoints.css");
+					@media (--small-landscape) {
+						header { color: red; }
+					}
+				`).To(BeParsedTo(`
+					@media (max-width: 30em) and (orientation: landscape) {
+						header { color: red; }
+					}
+				`, "/foo.css"))
+			})
+
+			It("undefined custom media generates a warning", func() {
+				input := strings.TrimSpace(heredoc.Doc(`
+					@media (--small) {
+						header { color: red; }
+					}
+				`))
+				output, warnings, err := css.ParseCss(&types.Config, input, "/foo.css")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(output).To(ContainSubstring("@media (--small)"))
+				Expect(warnings).To(HaveLen(1))
+				Expect(warnings[0].Text).To(Equal(`Custom media "--small" not defined in "/foo.css"`))
+				Expect(warnings[0].Line).To(Equal(1))
+				Expect(warnings[0].Column).To(Equal(8))
+				Expect(warnings[0].Length).To(Equal(len("--small")))
+			})
+		})
+
+		Describe("tokens", func() {
+			It("declares tokens as custom properties of :root", func() {
+				Expect(`
+					@tokens url("/lib/tokens/tokens.json");
+					header { color: var(--color-primary); }
+				`).To(BeParsedTo(`
+					:root {
+						--color-primary: #ff0000;
+						--color-secondary: blue;
+						--space-small: 4px;
+					}
+					header { color: var(--color-primary); }
+				`, "/foo.css"))
+			})
+
+			It("declares tokens within a rule", func() {
+				Expect(`
+					header {
+						@tokens url(/lib/tokens/tokens.yml);
+					}
+				`).To(BeParsedTo(`
+					header {
+						--font-size-body: 16px;
+						--font-weight: 400;
+					}
+				`, "/foo.css"))
+			})
+
+			It("escapes the names of tokens", func() {
+				output, _, err := css.ParseCss(&types.Config, `@tokens url("/lib/tokens/invalid.json");`, "/foo.css")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(output).To(ContainSubstring(`--space-0\2E 5: 2px;`))
+				Expect(output).To(ContainSubstring(`--space-large\20 gap: 32px;`))
+			})
+
+			It("ignores unsupported and invalid values with a warning", func() {
+				output, warnings, err := css.ParseCss(&types.Config, `@tokens url("/lib/tokens/invalid.json");`, "/foo.css")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(output).NotTo(ContainSubstring(`--font`))
+				Expect(output).NotTo(ContainSubstring(`--quote`))
+				Expect(output).NotTo(ContainSubstring(`color: red`))
+
+				Expect(warnings).To(HaveLen(3))
+				Expect(warnings[0].Text).To(Equal(
+					`Ignored design token "--font-families" of "/lib/tokens/invalid.json": arrays are not supported`,
+				))
+				Expect(warnings[1].Text).To(Equal(
+					`Ignored design token "--font-stack" of "/lib/tokens/invalid.json": semicolons are only allowed within brackets`,
+				))
+				Expect(warnings[2].Text).To(Equal(
+					`Ignored design token "--quote" of "/lib/tokens/invalid.json": unclosed string`,
+				))
+			})
+
+			It("unknown tokens file generates a warning", func() {
+				input := `@tokens url("/lib/tokens/unknown.json");`
+				output, warnings, err := css.ParseCss(&types.Config, input, "/foo.css")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(output).To(Equal(input))
+				Expect(warnings).To(HaveLen(1))
+				Expect(warnings[0].Text).To(HavePrefix(`Could not read tokens file "/lib/tokens/unknown.json"`))
+			})
+		})
+	})
+
+	Describe("ParseCssFile", func() {
+		var output string
+		var sourceMap struct {
+			Sources        []string
+			SourcesContent []string
+			Mappings       string
+		}
+
+		// Returns the source index, line and column that the first occurrence of `code` in the output
+		// is mapped to.
+		originalPosition := func(code string) (int, int, int) {
+			GinkgoHelper()
+
+			idx := strings.Index(output, code)
+			Expect(idx).To(BeNumerically(">=", 0))
+			line := strings.Count(output[:idx], "\n")
+			column := idx - strings.LastIndex(output[:idx], "\n") - 1
+
+			var segment [4]int
+			for i, mappings := range strings.Split(sourceMap.Mappings, ";") {
+				segment[0] = 0
+				for _, s := range strings.Split(mappings, ",") {
+					if s == "" {
+						continue
+					}
+
+					for j, value := range decodeVLQ(s) {
+						segment[j] += value
+					}
+
+					if i == line && segment[0] == column {
+						return segment[1], segment[2], segment[3]
+					}
+				}
+			}
+
+			Fail("No mapping for " + code)
+			return 0, 0, 0
+		}
+
+		BeforeEach(func() {
+			var err error
+			output, _, _, err = css.ParseCssFile(&types.Config,
+				path.Join(types.Config.RootPath, "lib/sourcemap/index.css"))
+			Expect(err).NotTo(HaveOccurred())
+
+			prefix := "/*# sourceMappingURL=data:application/json;base64,"
+			idx := strings.Index(output, prefix)
+			Expect(idx).To(BeNumerically(">", 0))
+
+			data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(
+				strings.TrimSuffix(strings.TrimSpace(output[idx+len(prefix):]), "*/")))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(json.Unmarshal(data, &sourceMap)).To(Succeed())
+		})
+
+		It("appends an inline source map", func() {
+			Expect(sourceMap.Sources).To(Equal([]string{"index.css", "../mixins/colors.css"}))
+			Expect(sourceMap.SourcesContent[1]).To(ContainSubstring("@define-mixin red"))
+		})
+
+		It("maps rules to the original file", func() {
+			source, line, column := originalPosition("font-size")
+			Expect([]int{source, line, column}).To(Equal([]int{0, 2, 2}))
+		})
+
+		It("maps rules included from a mixin to the mixin file", func() {
+			source, line, column := originalPosition("color")
+			Expect([]int{source, line, column}).To(Equal([]int{1, 1, 2}))
+		})
 	})
 })
+
+func decodeVLQ(segment string) []int {
+	const chars = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+
+	var values []int
+	value, shift := 0, 0
+	for _, c := range segment {
+		digit := strings.IndexRune(chars, c)
+		value += (digit & 31) << shift
+		shift += 5
+
+		if digit&32 == 0 {
+			if value&1 == 1 {
+				values = append(values, -(value >> 1))
+			} else {
+				values = append(values, value>>1)
+			}
+			value, shift = 0, 0
+		}
+	}
+
+	return values
+}
@@ -0,0 +1,87 @@
+package proscenium_test
+
+import (
+	"encoding/json"
+	b "joelmoss/proscenium/internal/builder"
+	"joelmoss/proscenium/internal/plugin"
+	"joelmoss/proscenium/internal/types"
+	. "joelmoss/proscenium/test/support"
+	"os"
+
+	esbuild "github.com/joelmoss/esbuild-internal/api"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// Loads Markdown files as a string of their contents.
+func markdownPlugin(config *types.ConfigT) esbuild.Plugin {
+	return esbuild.Plugin{
+		Name: "markdown",
+		Setup: func(build esbuild.PluginBuild) {
+			build.OnLoad(esbuild.OnLoadOptions{Filter: `\.md$`},
+				func(args esbuild.OnLoadArgs) (esbuild.OnLoadResult, error) {
+					data, err := os.ReadFile(args.Path)
+					if err != nil {
+						return esbuild.OnLoadResult{}, err
+					}
+
+					contents, _ := json.Marshal(string(data))
+					js := "export default " + string(contents) + ";"
+
+					return esbuild.OnLoadResult{Contents: &js, Loader: esbuild.LoaderJS}, nil
+				})
+		},
+	}
+}
+
+var _ = Describe("plugin.Register", func() {
+	BeforeEach(func() {
+		plugin.Register("markdown", markdownPlugin)
+	})
+
+	AfterEach(func() {
+		plugin.Unregister("markdown")
+	})
+
+	It("panics when registered twice", func() {
+		Expect(func() { plugin.Register("markdown", markdownPlugin) }).To(Panic())
+	})
+
+	It("returns enabled plugins in the configured order", func() {
+		plugin.Register("other", func(config *types.ConfigT) esbuild.Plugin {
+			return esbuild.Plugin{Name: "other"}
+		})
+		defer plugin.Unregister("other")
+
+		types.Config.Plugins = []string{"other", "markdown"}
+
+		plugins, err := plugin.Registered(&types.Config)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(plugins).To(HaveLen(2))
+		Expect(plugins[0].Name).To(Equal("other"))
+		Expect(plugins[1].Name).To(Equal("markdown"))
+	})
+
+	It("is not used unless enabled", func() {
+		plugins, err := plugin.Registered(&types.Config)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(plugins).To(BeEmpty())
+	})
+
+	It("errors on unknown plugins", func() {
+		types.Config.Plugins = []string{"graphql"}
+
+		success, code, _ := b.BuildToString(&types.Config, "lib/plugins/index.js")
+
+		Expect(success).To(BeFalse())
+		Expect(code).To(ContainSubstring(`No plugin is registered with the name \"graphql\"`))
+	})
+
+	It("builds with enabled plugins", func() {
+		types.Config.Plugins = []string{"markdown"}
+
+		_, code, _ := b.BuildToString(&types.Config, "lib/plugins/index.js")
+
+		Expect(code).To(ContainCode(`var hello_default = "# Hello\n";`))
+	})
+})
@@ -0,0 +1,134 @@
+package proscenium_test
+
+import (
+	"bufio"
+	b "joelmoss/proscenium/internal/builder"
+	"joelmoss/proscenium/internal/types"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ChangedAssets", func() {
+	var dir string
+
+	writeFile := func(name string, contents string) {
+		GinkgoHelper()
+
+		filePath := path.Join(dir, name)
+		Expect(os.WriteFile(filePath, []byte(contents), 0644)).To(Succeed())
+
+		future := time.Now().Add(time.Second)
+		Expect(os.Chtimes(filePath, future, future)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		types.Config.LiveReload = true
+
+		dir = path.Join(types.Config.RootPath, "lib", "reload")
+		Expect(os.MkdirAll(dir, 0755)).To(Succeed())
+
+		writeFile("dep.js", `export default "one";`)
+		writeFile("index.js", `import dep from "./dep"; console.log(dep);`)
+		writeFile("index.css", `body { color: red; }`)
+	})
+
+	AfterEach(func() {
+		b.ResetLiveReload()
+		os.RemoveAll(dir)
+	})
+
+	It("returns nothing when nothing has changed", func() {
+		b.BuildToString(&types.Config, "lib/reload/index.js")
+
+		Expect(b.ChangedAssets()).To(BeEmpty())
+	})
+
+	It("returns assets whose dependencies have changed", func() {
+		b.BuildToString(&types.Config, "lib/reload/index.js")
+		b.BuildToString(&types.Config, "lib/reload/index.css")
+
+		writeFile("dep.js", `export default "two";`)
+
+		Expect(b.ChangedAssets()).To(Equal([]string{"/lib/reload/index.js"}))
+		Expect(b.ChangedAssets()).To(BeEmpty())
+	})
+
+	It("returns changes that were also streamed", func() {
+		b.BuildToString(&types.Config, "lib/reload/index.css")
+
+		server := httptest.NewServer(b.LiveReloadHandler(10 * time.Millisecond))
+		defer server.Close()
+
+		res, err := http.Get(server.URL)
+		Expect(err).NotTo(HaveOccurred())
+		defer res.Body.Close()
+
+		writeFile("index.css", `body { color: blue; }`)
+
+		lines := make(chan string)
+		go func() {
+			defer GinkgoRecover()
+
+			scanner := bufio.NewScanner(res.Body)
+			for scanner.Scan() {
+				if line, ok := strings.CutPrefix(scanner.Text(), "data: "); ok {
+					lines <- line
+					return
+				}
+			}
+		}()
+
+		Eventually(lines, "2s").Should(Receive(MatchJSON(`{"path":"/lib/reload/index.css","type":"css"}`)))
+		Expect(b.ChangedAssets()).To(Equal([]string{"/lib/reload/index.css"}))
+	})
+
+	It("returns an asset again once it is rebuilt and changes again", func() {
+		b.BuildToString(&types.Config, "lib/reload/index.css")
+
+		writeFile("index.css", `body { color: blue; }`)
+		Expect(b.ChangedAssets()).To(Equal([]string{"/lib/reload/index.css"}))
+
+		b.BuildToString(&types.Config, "lib/reload/index.css")
+		Expect(b.ChangedAssets()).To(BeEmpty())
+
+		writeFile("index.css", `body { color: green; }`)
+		Expect(b.ChangedAssets()).To(Equal([]string{"/lib/reload/index.css"}))
+	})
+
+	It("streams changes as server-sent events", func() {
+		b.BuildToString(&types.Config, "lib/reload/index.css")
+
+		server := httptest.NewServer(b.LiveReloadHandler(10 * time.Millisecond))
+		defer server.Close()
+
+		res, err := http.Get(server.URL)
+		Expect(err).NotTo(HaveOccurred())
+		defer res.Body.Close()
+
+		Expect(res.Header.Get("Content-Type")).To(Equal("text/event-stream"))
+
+		writeFile("index.css", `body { color: blue; }`)
+
+		lines := make(chan string)
+		go func() {
+			defer GinkgoRecover()
+
+			scanner := bufio.NewScanner(res.Body)
+			for scanner.Scan() {
+				if line, ok := strings.CutPrefix(scanner.Text(), "data: "); ok {
+					lines <- line
+					return
+				}
+			}
+		}()
+
+		Eventually(lines, "2s").Should(Receive(MatchJSON(`{"path":"/lib/reload/index.css","type":"css"}`)))
+	})
+})
@@ -12,7 +12,7 @@ import (
 
 var _ = Describe("Resolve", func() {
 	It("resolves unknown path", func() {
-		relPath, absPath, err := r.Resolve("unknown", "")
+		relPath, absPath, err := r.Resolve(&types.Config, "unknown", "")
 
 		Expect(err).NotTo(Succeed())
 		Expect(relPath).To(Equal(""))
@@ -20,7 +20,7 @@ var _ = Describe("Resolve", func() {
 	})
 
 	It("resolves absolute path", func() {
-		relPath, absPath, _ := r.Resolve("/lib/foo.js", "")
+		relPath, absPath, _ := r.Resolve(&types.Config, "/lib/foo.js", "")
 
 		Expect(relPath).To(Equal("/lib/foo.js"))
 		Expect(absPath).To(Equal(filepath.Join(fixturesRoot, "/dummy/lib/foo.js")))
@@ -28,14 +28,14 @@ var _ = Describe("Resolve", func() {
 
 	When("relative path without importer", func() {
 		It("returns errors", func() {
-			_, _, err := r.Resolve("./lib/foo.js", "")
+			_, _, err := r.Resolve(&types.Config, "./lib/foo.js", "")
 			Expect(err).NotTo(Succeed())
 		})
 	})
 
 	When("importer is given", func() {
 		It("resolves relative path", func() {
-			relPath, absPath, _ := r.Resolve("./foo2.js", "/lib/foo.js")
+			relPath, absPath, _ := r.Resolve(&types.Config, "./foo2.js", "/lib/foo.js")
 
 			Expect(relPath).To(Equal("/lib/foo2.js"))
 			Expect(absPath).To(Equal(filepath.Join(fixturesRoot, "/dummy/lib/foo2.js")))
@@ -43,35 +43,35 @@ var _ = Describe("Resolve", func() {
 	})
 
 	It("resolves bare specifier", func() {
-		relPath, absPath, _ := r.Resolve("pkg", "")
+		relPath, absPath, _ := r.Resolve(&types.Config, "pkg", "")
 
 		Expect(relPath).To(Equal("/node_modules/pkg/index.js"))
 		Expect(absPath).To(Equal(filepath.Join(fixturesRoot, "/dummy/node_modules/pkg/index.js")))
 	})
 
 	It("resolves file:* pnpm install", func() {
-		relPath, absPath, _ := r.Resolve("pnpm-file/one.css", "")
+		relPath, absPath, _ := r.Resolve(&types.Config, "pnpm-file/one.css", "")
 
 		Expect(relPath).To(Equal("/node_modules/pnpm-file/one.css"))
 		Expect(absPath).To(Equal(filepath.Join(fixturesRoot, "/dummy/node_modules/pnpm-file/one.css")))
 	})
 
 	It("resolves external file:* pnpm install", func() {
-		relPath, absPath, _ := r.Resolve("pnpm-file-ext/one.css", "")
+		relPath, absPath, _ := r.Resolve(&types.Config, "pnpm-file-ext/one.css", "")
 
 		Expect(relPath).To(Equal("/node_modules/pnpm-file-ext/one.css"))
 		Expect(absPath).To(Equal(filepath.Join(fixturesRoot, "/dummy/node_modules/pnpm-file-ext/one.css")))
 	})
 
 	It("resolves link:* pnpm install", func() {
-		relPath, absPath, _ := r.Resolve("pnpm-link/one.css", "")
+		relPath, absPath, _ := r.Resolve(&types.Config, "pnpm-link/one.css", "")
 
 		Expect(relPath).To(Equal("/node_modules/pnpm-link/one.css"))
 		Expect(absPath).To(Equal(filepath.Join(fixturesRoot, "/dummy/node_modules/pnpm-link/one.css")))
 	})
 
 	It("resolves external link:* pnpm install", func() {
-		relPath, absPath, _ := r.Resolve("pnpm-link-ext/one.css", "")
+		relPath, absPath, _ := r.Resolve(&types.Config, "pnpm-link-ext/one.css", "")
 
 		Expect(relPath).To(Equal("/node_modules/pnpm-link-ext/one.css"))
 		Expect(absPath).To(Equal(filepath.Join(fixturesRoot, "/dummy/node_modules/pnpm-link-ext/one.css")))
@@ -80,7 +80,7 @@ var _ = Describe("Resolve", func() {
 	It("resolves @rubygems/* file:* pnpm install", func() {
 		addGem("gem_file", "dummy/vendor")
 
-		relPath, absPath, _ := r.Resolve("@rubygems/gem_file/index.module.css", "")
+		relPath, absPath, _ := r.Resolve(&types.Config, "@rubygems/gem_file/index.module.css", "")
 
 		Expect(relPath).To(Equal("/node_modules/@rubygems/gem_file/index.module.css"))
 		Expect(absPath).To(Equal(filepath.Join(fixturesRoot, "/dummy/vendor/gem_file/index.module.css")))
@@ -90,7 +90,7 @@ var _ = Describe("Resolve", func() {
 		It("resolves gem", func() {
 			addGem("gem1", "dummy/vendor")
 
-			relPath, absPath, _ := r.Resolve("@rubygems/gem1/index.js", "")
+			relPath, absPath, _ := r.Resolve(&types.Config, "@rubygems/gem1/index.js", "")
 
 			Expect(relPath).To(Equal("/node_modules/@rubygems/gem1/index.js"))
 			Expect(absPath).To(Equal(filepath.Join(fixturesRoot, "/dummy/vendor/gem1/index.js")))
@@ -99,7 +99,7 @@ var _ = Describe("Resolve", func() {
 		It("resolves gem without file extension", func() {
 			addGem("gem1", "dummy/vendor")
 
-			relPath, absPath, _ := r.Resolve("@rubygems/gem1", "")
+			relPath, absPath, _ := r.Resolve(&types.Config, "@rubygems/gem1", "")
 
 			Expect(relPath).To(Equal("/node_modules/@rubygems/gem1/index.js"))
 			Expect(absPath).To(Equal(filepath.Join(fixturesRoot, "/dummy/vendor/gem1/index.js")))
@@ -109,7 +109,7 @@ var _ = Describe("Resolve", func() {
 			addGem("gem3", "dummy/vendor")
 
 			importer := filepath.Join(types.Config.RootPath, "/vendor/gem3/lib/gem3/styles.module.css")
-			relPath, absPath, _ := r.Resolve("./red.css", importer)
+			relPath, absPath, _ := r.Resolve(&types.Config, "./red.css", importer)
 
 			Expect(relPath).To(Equal("/node_modules/@rubygems/gem3/lib/gem3/red.css"))
 			Expect(absPath).To(Equal(filepath.Join(fixturesRoot, "/dummy/vendor/gem3/lib/gem3/red.css")))
@@ -120,7 +120,7 @@ var _ = Describe("Resolve", func() {
 		It("resolves gem", func() {
 			addGem("gem2", "external")
 
-			relPath, absPath, _ := r.Resolve("@rubygems/gem2/lib/gem2/gem2.js", "")
+			relPath, absPath, _ := r.Resolve(&types.Config, "@rubygems/gem2/lib/gem2/gem2.js", "")
 
 			Expect(relPath).To(Equal("/node_modules/@rubygems/gem2/lib/gem2/gem2.js"))
 			Expect(absPath).To(Equal(filepath.Join(fixturesRoot, "/external/gem2/lib/gem2/gem2.js")))
@@ -129,7 +129,7 @@ var _ = Describe("Resolve", func() {
 		It("resolves gem without file extension", func() {
 			addGem("gem2", "external")
 
-			relPath, absPath, _ := r.Resolve("@rubygems/gem2/lib/gem2/gem2", "")
+			relPath, absPath, _ := r.Resolve(&types.Config, "@rubygems/gem2/lib/gem2/gem2", "")
 
 			Expect(relPath).To(Equal("/node_modules/@rubygems/gem2/lib/gem2/gem2.js"))
 			Expect(absPath).To(Equal(filepath.Join(fixturesRoot, "/external/gem2/lib/gem2/gem2.js")))
@@ -139,7 +139,7 @@ var _ = Describe("Resolve", func() {
 			addGem("gem4", "external")
 
 			importer := filepath.Join(types.Config.RootPath, "../external/gem4/lib/gem4/styles.module.css")
-			relPath, absPath, _ := r.Resolve("./red.css", importer)
+			relPath, absPath, _ := r.Resolve(&types.Config, "./red.css", importer)
 
 			Expect(relPath).To(Equal("/node_modules/@rubygems/gem4/lib/gem4/red.css"))
 			Expect(absPath).To(Equal(filepath.Join(fixturesRoot, "/external/gem4/lib/gem4/red.css")))
@@ -147,14 +147,14 @@ var _ = Describe("Resolve", func() {
 	})
 
 	It("resolves directory to its index file", func() {
-		relPath, absPath, _ := r.Resolve("/lib/indexes", "")
+		relPath, absPath, _ := r.Resolve(&types.Config, "/lib/indexes", "")
 
 		Expect(relPath).To(Equal("/lib/indexes/index.js"))
 		Expect(absPath).To(Equal(filepath.Join(fixturesRoot, "/dummy/lib/indexes/index.js")))
 	})
 
 	It("resolves file without extension", func() {
-		relPath, absPath, _ := r.Resolve("/lib/foo2", "")
+		relPath, absPath, _ := r.Resolve(&types.Config, "/lib/foo2", "")
 
 		Expect(relPath).To(Equal("/lib/foo2.js"))
 		Expect(absPath).To(Equal(filepath.Join(fixturesRoot, "/dummy/lib/foo2.js")))
@@ -163,7 +163,7 @@ var _ = Describe("Resolve", func() {
 
 func BenchmarkResolve(b *testing.B) {
 	for b.Loop() {
-		_, _, err := r.Resolve("/lib/foo2", "")
+		_, _, err := r.Resolve(&types.Config, "/lib/foo2", "")
 		if err != nil {
 			panic("Build failed: " + err.Error())
 		}
@@ -0,0 +1,61 @@
+package proscenium_test
+
+import (
+	b "joelmoss/proscenium/internal/builder"
+	"joelmoss/proscenium/internal/types"
+	. "joelmoss/proscenium/test/support"
+	"path/filepath"
+
+	"github.com/joelmoss/esbuild-internal/ast"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("BuildToString(ssr)", func() {
+	BeforeEach(func() {
+		types.Config.Ssr = true
+	})
+
+	It("does not define global as window", func() {
+		_, code, _ := b.BuildToString(&types.Config, "lib/ssr/component.js")
+
+		Expect(code).To(ContainCode(`globalThis.rendered =`))
+		Expect(code).NotTo(ContainSubstring(`window.rendered`))
+	})
+
+	It("exports only the class names of css modules", func() {
+		_, code, _ := b.BuildToString(&types.Config, "lib/ssr/component.js")
+
+		hash := ast.CssLocalHash(filepath.Join(types.Config.RootPath, "lib/styles.module.css"))
+		Expect(code).To(ContainSubstring(hash))
+		Expect(code).NotTo(ContainSubstring(`createElement('style')`))
+		Expect(code).NotTo(ContainSubstring(`document`))
+	})
+
+	It("exports the class names of css modules when CssModuleExports = true", func() {
+		types.Config.CssModuleExports = true
+
+		_, code, _ := b.BuildToString(&types.Config, "lib/css_module_exports/index.js")
+
+		hash := ast.CssLocalHash(filepath.Join(types.Config.RootPath, "lib/css_module_exports/styles.module.css"))
+		Expect(code).To(ContainCode(`var button = "button_` + hash + `_lib-css_module_exports-styles-module";`))
+		Expect(code).NotTo(ContainSubstring(`new Proxy`))
+		Expect(code).NotTo(ContainSubstring(`document`))
+	})
+
+	It("bundles when unbundling", func() {
+		types.Config.Bundle = false
+
+		_, code, _ := b.BuildToString(&types.Config, "lib/importing/package.js")
+
+		Expect(code).To(ContainCode(`console.log("pkg/one.js");`))
+	})
+
+	It("does not write outputs", func() {
+		success, _, _ := b.BuildToString(&types.Config, "lib/ssr/component.js")
+		Expect(success).To(BeTrue())
+
+		matches, _ := filepath.Glob(filepath.Join(types.Config.RootPath, types.Config.OutputDir, "lib/ssr/*"))
+		Expect(matches).To(BeEmpty())
+	})
+})
@@ -2,6 +2,7 @@ package proscenium_test
 
 import (
 	b "joelmoss/proscenium/internal/builder"
+	"joelmoss/proscenium/internal/types"
 	. "joelmoss/proscenium/test/support"
 	"regexp"
 
@@ -36,14 +37,14 @@ var _ = Describe("b.BuildToString(svg)", func() {
 		})
 
 		It("bundles", func() {
-			_, code, _ := b.BuildToString("lib/svg/internal_rubygem.jsx")
+			_, code, _ := b.BuildToString(&types.Config, "lib/svg/internal_rubygem.jsx")
 
 			Expect(code).To(ContainCode(`svg = /* @__PURE__ */ (0, import_jsx_runtime.jsx)("svg"`))
 			Expect(code).NotTo(ContainCode(`import AtIcon from "@rubygems/gem1/at.svg";`))
 		})
 
 		It("resolves, but does not bundle from css", func() {
-			_, code, _ := b.BuildToString("lib/svg/internal_rubygem.css")
+			_, code, _ := b.BuildToString(&types.Config, "lib/svg/internal_rubygem.css")
 
 			Expect(code).To(ContainCode(`
 				url(/node_modules/@rubygems/gem1/at.svg)`,
@@ -57,14 +58,14 @@ var _ = Describe("b.BuildToString(svg)", func() {
 		})
 
 		It("bundles", func() {
-			_, code, _ := b.BuildToString("lib/svg/external_rubygem.jsx")
+			_, code, _ := b.BuildToString(&types.Config, "lib/svg/external_rubygem.jsx")
 
 			Expect(code).To(ContainCode(`svg = /* @__PURE__ */ (0, import_jsx_runtime.jsx)("svg"`))
 			Expect(code).NotTo(ContainCode(`import AtIcon from "@rubygems/gem2/at.svg";`))
 		})
 
 		It("resolves, but does not bundle from css", func() {
-			_, code, _ := b.BuildToString("lib/svg/external_rubygem.css")
+			_, code, _ := b.BuildToString(&types.Config, "lib/svg/external_rubygem.css")
 
 			Expect(code).To(ContainCode(`
 				url(/node_modules/@rubygems/gem2/at.svg)`,
@@ -73,7 +74,7 @@ var _ = Describe("b.BuildToString(svg)", func() {
 	})
 
 	It("does not bundle svg from css", func() {
-		_, code, _ := b.BuildToString("lib/svg/svg.css")
+		_, code, _ := b.BuildToString(&types.Config, "lib/svg/svg.css")
 
 		Expect(code).To(ContainCode(`
 			url(/hue/icons/angle-right-regular.svg)`,
@@ -83,7 +84,7 @@ var _ = Describe("b.BuildToString(svg)", func() {
 	It("bundles remote svg from jsx", func() {
 		MockURL("/at.svg", svgContent)
 
-		_, code, _ := b.BuildToString("lib/svg/remote.jsx")
+		_, code, _ := b.BuildToString(&types.Config, "lib/svg/remote.jsx")
 
 		Expect(code).To(ContainCode(`
 			var svg = /* @__PURE__ */ jsx("svg", { "aria-hidden": "true", focusable: "false", role: "img", xmlns: "http://www.w3.org/2000/svg", viewBox: "0 0 512 512", children: /* @__PURE__ */ jsx("path", { fill: "currentColor", d: "M504" }) });
@@ -99,7 +100,7 @@ var _ = Describe("b.BuildToString(svg)", func() {
 		PIt("should not bundle or encode; leave as is", func() {
 			MockURL("/at.svg", svgContent)
 
-			_, code, _ := b.BuildToString("lib/svg/remote.css")
+			_, code, _ := b.BuildToString(&types.Config, "lib/svg/remote.css")
 
 			Expect(code).To(ContainCode(`background-image: url(https://proscenium.test/at.svg);`))
 		})
@@ -0,0 +1,120 @@
+package proscenium_test
+
+import (
+	b "joelmoss/proscenium/internal/builder"
+	"joelmoss/proscenium/internal/types"
+	"joelmoss/proscenium/internal/utils"
+	. "joelmoss/proscenium/test/support"
+
+	esbuild "github.com/joelmoss/esbuild-internal/api"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Targets", func() {
+	Describe("ParseTargets", func() {
+		It("parses engine versions", func() {
+			target, engines, err := utils.ParseTargets([]string{"chrome100", "safari 15.4", "ios_saf >= 15"})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(target).To(Equal(esbuild.DefaultTarget))
+			Expect(engines).To(ConsistOf(
+				esbuild.Engine{Name: esbuild.EngineChrome, Version: "100"},
+				esbuild.Engine{Name: esbuild.EngineSafari, Version: "15.4"},
+				esbuild.Engine{Name: esbuild.EngineIOS, Version: "15"},
+			))
+		})
+
+		It("parses ES versions", func() {
+			target, engines, err := utils.ParseTargets([]string{"ES2020", "firefox100"})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(target).To(Equal(esbuild.ES2020))
+			Expect(engines).To(HaveLen(1))
+		})
+
+		It("uses the lowest version of each engine", func() {
+			_, engines, err := utils.ParseTargets([]string{"chrome 100", "and_chr 90.1", "chrome 110"})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(engines).To(Equal([]esbuild.Engine{{Name: esbuild.EngineChrome, Version: "90.1"}}))
+		})
+
+		It("errors on unsupported queries", func() {
+			_, _, err := utils.ParseTargets([]string{"> 0.5%"})
+			Expect(err).To(MatchError(ContainSubstring(`Unsupported target "> 0.5%"`)))
+
+			_, _, err = utils.ParseTargets([]string{"defaults"})
+			Expect(err).To(MatchError(ContainSubstring(`Unsupported target "defaults"; browserslist queries are not supported`)))
+
+			_, _, err = utils.ParseTargets([]string{"netscape4"})
+			Expect(err).To(MatchError(ContainSubstring(`Unsupported target engine "netscape"`)))
+		})
+	})
+
+	Describe("ApplyTargets", func() {
+		It("defaults to ES2022", func() {
+			var options esbuild.BuildOptions
+			Expect(utils.ApplyTargets(&types.Config, &options)).To(Succeed())
+
+			Expect(options.Target).To(Equal(esbuild.ES2022))
+			Expect(options.Supported).To(HaveKeyWithValue("nesting", false))
+		})
+
+		It("transforms CSS nesting when only an ES version is targeted", func() {
+			types.Config.Targets = []string{"es2020"}
+
+			var options esbuild.BuildOptions
+			Expect(utils.ApplyTargets(&types.Config, &options)).To(Succeed())
+
+			Expect(options.Target).To(Equal(esbuild.ES2020))
+			Expect(options.Engines).To(BeEmpty())
+			Expect(options.Supported).To(HaveKeyWithValue("nesting", false))
+		})
+
+		It("prefers the targets of the environment", func() {
+			types.Config.Environment = types.ProdEnv
+			types.Config.Targets = []string{"chrome100"}
+			types.Config.EnvironmentTargets = map[string][]string{"production": {"chrome80"}}
+
+			var options esbuild.BuildOptions
+			Expect(utils.ApplyTargets(&types.Config, &options)).To(Succeed())
+
+			Expect(options.Engines).To(Equal([]esbuild.Engine{{Name: esbuild.EngineChrome, Version: "80"}}))
+			Expect(options.Supported).To(BeNil())
+		})
+	})
+
+	It("lowers JS syntax", func() {
+		types.Config.Targets = []string{"chrome79"}
+
+		_, code, _ := b.BuildToString(&types.Config, "lib/targets/optional_chaining.js")
+
+		Expect(code).NotTo(ContainSubstring(`a?.b`))
+	})
+
+	It("keeps CSS nesting when supported", func() {
+		types.Config.Targets = []string{"chrome120"}
+
+		_, code, _ := b.BuildToString(&types.Config, "lib/targets/nesting.css")
+
+		Expect(code).To(ContainCode(`.parent { .child { color: red; } }`))
+	})
+
+	It("lowers CSS nesting when only an ES version is targeted", func() {
+		types.Config.Targets = []string{"es2020"}
+
+		_, code, _ := b.BuildToString(&types.Config, "lib/targets/nesting.css")
+
+		Expect(code).To(ContainCode(`.parent .child { color: red; }`))
+	})
+
+	It("returns an error for invalid targets", func() {
+		types.Config.Targets = []string{"last 2 versions"}
+
+		success, code, _ := b.BuildToString(&types.Config, "lib/targets/optional_chaining.js")
+
+		Expect(success).To(BeFalse())
+		Expect(code).To(ContainSubstring(`Invalid targets`))
+	})
+})